@@ -0,0 +1,266 @@
+package intellexer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState int
+
+// These are the states of a circuit breaker. A closed breaker lets requests
+// through. After enough consecutive failures it opens, rejecting requests
+// until its cooldown expires. It then becomes half-open, letting a single probe
+// request through; the breaker closes if the probe succeeds and opens again if
+// it fails.
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker stops calls to a failing backend after repeated failures, and
+// periodically probes it to see if it has recovered. It is safe for concurrent
+// use.
+type CircuitBreaker struct {
+	failureThreshold int
+	cooldown         time.Duration
+	now              func() time.Time
+	onStateChange    func(from, to BreakerState)
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker returns a closed circuit breaker that opens after
+// failureThreshold consecutive failures and probes again after cooldown.
+func NewCircuitBreaker(failureThreshold int, cooldown time.Duration) *CircuitBreaker {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+	return &CircuitBreaker{
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		now:              time.Now,
+	}
+}
+
+// WithStateChange sets a callback that is called whenever the breaker changes
+// state, for instance to alert when it opens. The callback is called
+// synchronously, without any locks held.
+func (b *CircuitBreaker) WithStateChange(callback func(from, to BreakerState)) *CircuitBreaker {
+	b.onStateChange = callback
+	return b
+}
+
+// setState changes the state of the breaker, and returns a function that
+// notifies the state change callback (if any). Must be called with b.mu held,
+// and the returned function called after it is released.
+func (b *CircuitBreaker) setState(to BreakerState) func() {
+	from := b.state
+	b.state = to
+	if from == to || b.onStateChange == nil {
+		return func() {}
+	}
+	callback := b.onStateChange
+	return func() { callback(from, to) }
+}
+
+// Allow reports whether a call should be attempted. Every call that is allowed
+// must be followed by a call to Success, Failure or Release.
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			b.mu.Unlock()
+			return false
+		}
+		notify := b.setState(BreakerHalfOpen)
+		b.probing = true
+		b.mu.Unlock()
+		notify()
+		return true
+	case BreakerHalfOpen:
+		// Only one probe at a time
+		allowed := !b.probing
+		b.probing = true
+		b.mu.Unlock()
+		return allowed
+	}
+	b.mu.Unlock()
+	return true
+}
+
+// Success records a successful call, closing the breaker.
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	b.failures = 0
+	b.probing = false
+	notify := b.setState(BreakerClosed)
+	b.mu.Unlock()
+	notify()
+}
+
+// Failure records a failed call, opening the breaker if the failure threshold
+// has been reached or if the call was a half-open probe.
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	b.failures++
+	b.probing = false
+	notify := func() {}
+	if b.state == BreakerHalfOpen || b.failures >= b.failureThreshold {
+		notify = b.setState(BreakerOpen)
+		b.openedAt = b.now()
+	}
+	b.mu.Unlock()
+	notify()
+}
+
+// Release ends an allowed call without recording an outcome, for calls that
+// were abandoned by the caller or failed before reaching the backend.
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// BreakerOpenError is returned by Client when a request is rejected because the
+// circuit breaker for its endpoint is open.
+type BreakerOpenError struct {
+	Endpoint string
+}
+
+func (err BreakerOpenError) Error() string {
+	return fmt.Sprintf("Circuit breaker for endpoint %s is open", err.Endpoint)
+}
+
+// BreakerConfig configures the per-endpoint circuit breakers of a Client.
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens an
+	// endpoint's breaker.
+	FailureThreshold int
+	// Cooldown is how long a breaker stays open before probing the endpoint.
+	Cooldown time.Duration
+	// IsFailure decides which API response status codes count as failures.
+	// Requests that could not be sent at all always count as failures. If nil,
+	// DefaultIsFailure is used.
+	IsFailure func(statusCode int) bool
+	// OnStateChange, if set, is called whenever an endpoint's breaker changes
+	// state.
+	OnStateChange func(endpoint string, from, to BreakerState)
+}
+
+// DefaultIsFailure counts server errors (5xx) and rate limiting (429) as
+// failures. Other client errors mean the API is up, so they don't count.
+func DefaultIsFailure(statusCode int) bool {
+	return statusCode >= 500 || statusCode == http.StatusTooManyRequests
+}
+
+// breakerSet lazily creates one circuit breaker per endpoint.
+type breakerSet struct {
+	config   BreakerConfig
+	mu       sync.Mutex
+	breakers map[string]*CircuitBreaker
+}
+
+func (bs *breakerSet) get(endpoint string) *CircuitBreaker {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	breaker, ok := bs.breakers[endpoint]
+	if !ok {
+		breaker = NewCircuitBreaker(bs.config.FailureThreshold, bs.config.Cooldown)
+		if callback := bs.config.OnStateChange; callback != nil {
+			breaker.WithStateChange(func(from, to BreakerState) {
+				callback(endpoint, from, to)
+			})
+		}
+		bs.breakers[endpoint] = breaker
+	}
+	return breaker
+}
+
+// record reports the outcome of a request to a breaker. Requests cancelled by
+// the caller and requests that failed on our side, such as uploads over the
+// size limit, say nothing about the health of the API, so they aren't counted.
+func (bs *breakerSet) record(breaker *CircuitBreaker, req *http.Request, res *http.Response, err error) {
+	if req.Context().Err() != nil || err != nil && IsLocalError(err) {
+		breaker.Release()
+		return
+	}
+	isFailure := bs.config.IsFailure
+	if isFailure == nil {
+		isFailure = DefaultIsFailure
+	}
+	if err != nil || isFailure(res.StatusCode) {
+		breaker.Failure()
+		return
+	}
+	breaker.Success()
+}
+
+// IsLocalError reports whether err happened without the API being involved:
+// invalid input, such as a ReviewIDError or DocumentTooLargeError, or a request
+// cancelled by the caller. Such errors say nothing about the health of the API,
+// so they don't count against circuit breakers or cause a fallback.
+func IsLocalError(err error) bool {
+	cause := errors.Cause(err)
+	if urlErr, ok := cause.(*url.Error); ok {
+		cause = urlErr.Err
+	}
+	switch cause.(type) {
+	case DocumentTooLargeError, ReviewIDError:
+		return true
+	}
+	return cause == context.Canceled
+}
+
+// WithCircuitBreaker enables circuit breaking, with a separate breaker for each
+// API endpoint. Requests to an endpoint whose breaker is open fail immediately
+// with a BreakerOpenError instead of waiting on a degraded API.
+func (c *Client) WithCircuitBreaker(config BreakerConfig) *Client {
+	c.breakers = &breakerSet{
+		config:   config,
+		breakers: make(map[string]*CircuitBreaker),
+	}
+	return c
+}
+
+// BreakerState returns the state of the circuit breaker for an endpoint, e.g.
+// "analyzeSentiments". Endpoints that haven't been called yet, and all
+// endpoints on a client without circuit breaking, are closed.
+func (c *Client) BreakerState(endpoint string) BreakerState {
+	if c.breakers == nil {
+		return BreakerClosed
+	}
+	return c.breakers.get(endpoint).State()
+}
+
+// State returns the current state of the breaker. An open breaker whose
+// cooldown has expired is reported as open until the next call to Allow.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
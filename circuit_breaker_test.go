@@ -0,0 +1,167 @@
+package intellexer
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amccarthy1/intellexer/mocks"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a manually advanced clock for testing time-based behavior.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	breaker := NewCircuitBreaker(3, time.Minute)
+	breaker.now = clock.Now
+
+	assert.Equal(t, BreakerClosed, breaker.State())
+	for i := 0; i < 2; i++ {
+		assert.True(t, breaker.Allow())
+		breaker.Failure()
+	}
+	assert.Equal(t, BreakerClosed, breaker.State())
+	// A success resets the count
+	assert.True(t, breaker.Allow())
+	breaker.Success()
+	for i := 0; i < 3; i++ {
+		assert.True(t, breaker.Allow())
+		breaker.Failure()
+	}
+	assert.Equal(t, BreakerOpen, breaker.State())
+	assert.False(t, breaker.Allow())
+
+	// After the cooldown a single probe is allowed
+	clock.Advance(time.Minute)
+	assert.True(t, breaker.Allow())
+	assert.Equal(t, BreakerHalfOpen, breaker.State())
+	assert.False(t, breaker.Allow())
+	// A failed probe opens the breaker again
+	breaker.Failure()
+	assert.Equal(t, BreakerOpen, breaker.State())
+	assert.False(t, breaker.Allow())
+
+	clock.Advance(time.Minute)
+	assert.True(t, breaker.Allow())
+	breaker.Success()
+	assert.Equal(t, BreakerClosed, breaker.State())
+	assert.True(t, breaker.Allow())
+	assert.Equal(t, "closed", breaker.State().String())
+	assert.Equal(t, "half-open", BreakerHalfOpen.String())
+}
+
+func TestCircuitBreakerStateChanges(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	var changes []string
+	breaker := NewCircuitBreaker(1, time.Minute).WithStateChange(func(from, to BreakerState) {
+		changes = append(changes, from.String()+"->"+to.String())
+	})
+	breaker.now = clock.Now
+
+	breaker.Allow()
+	breaker.Success()
+	breaker.Allow()
+	breaker.Failure()
+	clock.Advance(time.Minute)
+	breaker.Allow()
+	breaker.Success()
+	assert.Equal(t, []string{"closed->open", "open->half-open", "half-open->closed"}, changes)
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	client := mocks.NewScriptedClient()
+	client.On("POST", "analyzeSentiments").Respond(503, "Unavailable")
+	client.On("GET", "sentimentAnalyzerOntologies").
+		Respond(404, "Not found").
+		Respond(200, `["Hotels"]`)
+	var changes []string
+	apiClient := NewClient("test").WithBaseURL("FAKEURL").WithHTTPClient(client).
+		WithCircuitBreaker(BreakerConfig{
+			FailureThreshold: 2,
+			Cooldown:         time.Hour,
+			OnStateChange: func(endpoint string, from, to BreakerState) {
+				changes = append(changes, endpoint+":"+to.String())
+			},
+		})
+	reviews := []Review{{ID: "1", Text: "foo"}}
+
+	for i := 0; i < 2; i++ {
+		_, err := apiClient.AnalyzeSentiments(Hotels, reviews)
+		assert.Contains(t, err.Error(), "Server Error")
+	}
+	assert.Equal(t, BreakerOpen, apiClient.BreakerState("analyzeSentiments"))
+	_, err := apiClient.AnalyzeSentiments(Hotels, reviews)
+	assert.Equal(t, BreakerOpenError{"analyzeSentiments"}, errors.Cause(err))
+	assert.Equal(t, "Circuit breaker for endpoint analyzeSentiments is open", errors.Cause(err).Error())
+	client.AssertCallCount(t, "POST", "analyzeSentiments", 2)
+	assert.Equal(t, []string{"analyzeSentiments:open"}, changes)
+
+	// Other endpoints have their own breaker, and 4xx responses don't count
+	_, err = apiClient.ListOntologies()
+	assert.Contains(t, err.Error(), "Request Error")
+	ontologies, err := apiClient.ListOntologies()
+	assert.Nil(t, err)
+	assert.Len(t, ontologies, 1)
+	assert.Equal(t, BreakerClosed, apiClient.BreakerState("sentimentAnalyzerOntologies"))
+	assert.Equal(t, BreakerClosed, NewClient("test").BreakerState("analyzeSentiments"))
+}
+
+func TestClientCircuitBreakerIsFailure(t *testing.T) {
+	client := mocks.NewScriptedClient()
+	client.On("GET", "sentimentAnalyzerOntologies").Respond(401, "Unauthorized")
+	apiClient := NewClient("test").WithBaseURL("FAKEURL").WithHTTPClient(client).
+		WithCircuitBreaker(BreakerConfig{
+			FailureThreshold: 1,
+			Cooldown:         time.Hour,
+			IsFailure:        func(code int) bool { return code == 401 },
+		})
+	apiClient.ListOntologies()
+	_, err := apiClient.ListOntologies()
+	assert.Equal(t, BreakerOpenError{"sentimentAnalyzerOntologies"}, errors.Cause(err))
+	assert.True(t, DefaultIsFailure(500))
+	assert.True(t, DefaultIsFailure(429))
+	assert.False(t, DefaultIsFailure(401))
+}
+
+func TestClientCircuitBreakerLocalErrors(t *testing.T) {
+	server := newUploadServer(t, func(r *http.Request, body []byte) {})
+	defer server.Close()
+	apiClient := NewClient("test").WithBaseURL(server.URL).WithHTTPClient(http.DefaultClient).
+		WithMaxDocumentSize(10).
+		WithCircuitBreaker(BreakerConfig{FailureThreshold: 1, Cooldown: time.Hour})
+
+	// The size isn't known up front, so the upload fails midway
+	body := io.MultiReader(strings.NewReader(strings.Repeat("a", 100)))
+	_, err := apiClient.GetTopicsFromUpload(context.Background(), Upload{Body: body})
+	assert.IsType(t, DocumentTooLargeError{}, errors.Cause(err))
+	assert.Equal(t, BreakerClosed, apiClient.BreakerState("getTopicsFromFile"))
+
+	topics, err := apiClient.GetTopicsFromText("tech")
+	assert.Nil(t, err)
+	assert.Len(t, topics, 2)
+}
+
+func TestIsLocalError(t *testing.T) {
+	assert.True(t, IsLocalError(ReviewIDError{Index: 1}))
+	assert.True(t, IsLocalError(errors.Wrap(DocumentTooLargeError{}, "Error")))
+	assert.True(t, IsLocalError(&url.Error{Op: "Post", URL: "x", Err: context.Canceled}))
+	assert.False(t, IsLocalError(&url.Error{Op: "Post", URL: "x", Err: context.DeadlineExceeded}))
+	assert.False(t, IsLocalError(io.ErrUnexpectedEOF))
+}
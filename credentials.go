@@ -0,0 +1,185 @@
+package intellexer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Redacted replaces API keys in errors, URLs and recorded fixtures.
+const Redacted = "REDACTED"
+
+// CredentialProvider supplies the API key for each request. Providers are
+// asked for the key on every request, so they can refresh it at runtime, for
+// instance when it is rotated.
+type CredentialProvider interface {
+	APIKey() (string, error)
+}
+
+// StaticKey is a CredentialProvider that always returns the same key.
+type StaticKey string
+
+// APIKey returns the key.
+func (k StaticKey) APIKey() (string, error) {
+	if len(k) == 0 {
+		return "", errors.New("API key is empty")
+	}
+	return string(k), nil
+}
+
+// EnvCredentials is a CredentialProvider that reads the key from an environment
+// variable on every request.
+type EnvCredentials string
+
+// APIKey returns the current value of the environment variable.
+func (name EnvCredentials) APIKey() (string, error) {
+	key, ok := os.LookupEnv(string(name))
+	if !ok || len(key) == 0 {
+		return "", errors.Errorf("Environment variable %s is not set", string(name))
+	}
+	return key, nil
+}
+
+// FileCredentials is a CredentialProvider that reads the key from a file, such
+// as a mounted secret. The file is re-read whenever it changes, so the key can
+// be rotated without restarting.
+type FileCredentials struct {
+	path string
+
+	mu      sync.Mutex
+	key     string
+	modTime time.Time
+}
+
+// NewFileCredentials returns a provider reading the key from the file at path.
+// Leading and trailing whitespace in the file is ignored.
+func NewFileCredentials(path string) *FileCredentials {
+	return &FileCredentials{path: path}
+}
+
+// APIKey returns the key from the file, re-reading it if it has changed.
+func (fc *FileCredentials) APIKey() (string, error) {
+	info, err := os.Stat(fc.path)
+	if err != nil {
+		return "", errors.Wrap(err, "Error reading API key file")
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if len(fc.key) > 0 && info.ModTime().Equal(fc.modTime) {
+		return fc.key, nil
+	}
+	contents, err := ioutil.ReadFile(fc.path)
+	if err != nil {
+		return "", errors.Wrap(err, "Error reading API key file")
+	}
+	key := strings.TrimSpace(string(contents))
+	if len(key) == 0 {
+		return "", errors.Errorf("API key file %s is empty", fc.path)
+	}
+	fc.key, fc.modTime = key, info.ModTime()
+	return key, nil
+}
+
+// WithCredentials makes the client ask provider for its API key on every
+// request, instead of using the key it was created with.
+func (c *Client) WithCredentials(provider CredentialProvider) *Client {
+	c.credentials = provider
+	return c
+}
+
+// WithHeaderAuth sends the API key in the named request header instead of the
+// apiKey query parameter, which keeps it out of URLs and therefore out of
+// access logs. This is only useful behind a gateway or proxy that accepts it,
+// the public API expects the query parameter.
+func (c *Client) WithHeaderAuth(header string) *Client {
+	c.authHeader = header
+	return c
+}
+
+// RedactURL returns a copy of u with the apiKey query parameter redacted,
+// suitable for logging.
+func RedactURL(u *url.URL) *url.URL {
+	redacted := *u
+	query := u.Query()
+	if _, ok := query["apiKey"]; ok {
+		query.Set("apiKey", Redacted)
+		redacted.RawQuery = query.Encode()
+	}
+	return &redacted
+}
+
+// redactRequest returns a copy of an authorized request with the API key
+// removed, so it can be safely attached to responses and errors.
+func (c *Client) redactRequest(req *http.Request) *http.Request {
+	redacted := req.WithContext(req.Context())
+	redacted.URL = RedactURL(req.URL)
+	if len(c.authHeader) > 0 {
+		redacted.Header = cloneHeader(req.Header)
+		redacted.Header.Set(c.authHeader, Redacted)
+	}
+	return redacted
+}
+
+// cloneHeader returns a deep copy of h. It stands in for http.Header.Clone,
+// which needs Go 1.13.
+func cloneHeader(h http.Header) http.Header {
+	clone := make(http.Header, len(h))
+	for key, values := range h {
+		clone[key] = append([]string(nil), values...)
+	}
+	return clone
+}
+
+// redactedError is an error whose message had an API key scrubbed from it. It
+// doesn't keep the original error, which still holds the key, but reports
+// Timeout and Temporary like it did.
+type redactedError struct {
+	msg       string
+	timeout   bool
+	temporary bool
+}
+
+func (err redactedError) Error() string {
+	return err.msg
+}
+
+// Timeout reports whether the original error was a timeout.
+func (err redactedError) Timeout() bool {
+	return err.timeout
+}
+
+// Temporary reports whether the original error was temporary.
+func (err redactedError) Temporary() bool {
+	return err.temporary
+}
+
+// redactError scrubs key from err and the errors it wraps. Errors from
+// net/http include the request URL, and therefore the key if it was sent as a
+// query parameter; those keep their *url.Error type with the URL redacted in
+// place.
+func redactError(err error, key string) error {
+	if err == nil || len(key) == 0 || !strings.Contains(err.Error(), key) {
+		return err
+	}
+	if urlErr, ok := err.(*url.Error); ok {
+		return &url.Error{
+			Op:  urlErr.Op,
+			URL: strings.Replace(urlErr.URL, key, Redacted, -1),
+			Err: redactError(urlErr.Err, key),
+		}
+	}
+	redacted := redactedError{msg: strings.Replace(err.Error(), key, Redacted, -1)}
+	if timeout, ok := err.(interface{ Timeout() bool }); ok {
+		redacted.timeout = timeout.Timeout()
+	}
+	if temporary, ok := err.(interface{ Temporary() bool }); ok {
+		redacted.temporary = temporary.Temporary()
+	}
+	return redacted
+}
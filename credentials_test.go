@@ -0,0 +1,167 @@
+package intellexer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/amccarthy1/intellexer/mocks"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaticAndEnvCredentials(t *testing.T) {
+	key, err := StaticKey("abc").APIKey()
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", key)
+	_, err = StaticKey("").APIKey()
+	assert.NotNil(t, err)
+
+	os.Setenv("INTELLEXER_TEST_KEY", "from-env")
+	defer os.Unsetenv("INTELLEXER_TEST_KEY")
+	key, err = EnvCredentials("INTELLEXER_TEST_KEY").APIKey()
+	assert.Nil(t, err)
+	assert.Equal(t, "from-env", key)
+	_, err = EnvCredentials("INTELLEXER_TEST_MISSING").APIKey()
+	assert.Equal(t, "Environment variable INTELLEXER_TEST_MISSING is not set", err.Error())
+}
+
+func TestFileCredentials(t *testing.T) {
+	file, err := ioutil.TempFile("", "apikey")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	file.WriteString("first-key\n")
+	file.Close()
+
+	provider := NewFileCredentials(file.Name())
+	key, err := provider.APIKey()
+	assert.Nil(t, err)
+	assert.Equal(t, "first-key", key)
+
+	// Rotate the key
+	assert.Nil(t, ioutil.WriteFile(file.Name(), []byte("second-key"), 0600))
+	later := time.Now().Add(time.Hour)
+	assert.Nil(t, os.Chtimes(file.Name(), later, later))
+	key, err = provider.APIKey()
+	assert.Nil(t, err)
+	assert.Equal(t, "second-key", key)
+
+	assert.Nil(t, ioutil.WriteFile(file.Name(), []byte("  "), 0600))
+	assert.Nil(t, os.Chtimes(file.Name(), later.Add(time.Hour), later.Add(time.Hour)))
+	_, err = provider.APIKey()
+	assert.Contains(t, err.Error(), "is empty")
+
+	_, err = NewFileCredentials("/does/not/exist").APIKey()
+	assert.Contains(t, err.Error(), "Error reading API key file")
+}
+
+func TestWithCredentials(t *testing.T) {
+	scripted := mocks.NewScriptedClient()
+	scripted.On("GET", "sentimentAnalyzerOntologies").Respond(200, `[]`)
+	client := NewClient("unused").WithBaseURL("FAKEURL").WithHTTPClient(scripted)
+
+	os.Setenv("INTELLEXER_TEST_KEY", "env-key")
+	defer os.Unsetenv("INTELLEXER_TEST_KEY")
+	client.WithCredentials(EnvCredentials("INTELLEXER_TEST_KEY"))
+	_, err := client.ListOntologies()
+	assert.Nil(t, err)
+	scripted.Requests()[0].AssertQuery(t, "apiKey", "env-key")
+
+	client.WithCredentials(EnvCredentials("INTELLEXER_TEST_MISSING"))
+	_, err = client.ListOntologies()
+	assert.Contains(t, err.Error(), "Error getting API key")
+	assert.Len(t, scripted.Requests(), 1)
+}
+
+func TestHeaderAuth(t *testing.T) {
+	scripted := mocks.NewScriptedClient()
+	scripted.On("GET", "sentimentAnalyzerOntologies").Respond(401, "Unauthorized")
+	client := NewClient("secret").WithBaseURL("FAKEURL").WithHTTPClient(scripted).WithHeaderAuth("X-API-Key")
+	_, err := client.ListOntologies()
+	assert.NotNil(t, err)
+
+	sent := scripted.Requests()[0]
+	assert.Equal(t, "secret", sent.Header.Get("X-API-Key"))
+	assert.Empty(t, sent.URL.Query().Get("apiKey"))
+
+	// The request attached to the error has the key redacted
+	res := errors.Cause(err).(APIError).Response
+	assert.Equal(t, Redacted, res.Request.Header.Get("X-API-Key"))
+	// The fake server accepts the key in a header
+	server := mocks.NewFakeServer("secret").WithAuthHeader("X-Key")
+	defer server.Close()
+	client = NewClient("secret").WithBaseURL(server.URL).WithHTTPClient(http.DefaultClient).WithHeaderAuth("X-Key")
+	_, err = client.ListOntologies()
+	assert.Nil(t, err)
+	client.WithHeaderAuth("X-Other")
+	_, err = client.ListOntologies()
+	assert.Contains(t, err.Error(), "401")
+}
+
+func TestRedaction(t *testing.T) {
+	u, err := url.Parse("https://api.intellexer.com/foo?apiKey=secret&url=bar")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://api.intellexer.com/foo?apiKey=REDACTED&url=bar", RedactURL(u).String())
+	assert.Equal(t, "https://api.intellexer.com/foo?apiKey=secret&url=bar", u.String())
+
+	// Transport errors include the URL
+	client := NewClient("secret").WithBaseURL("http://127.0.0.1:1").WithHTTPClient(http.DefaultClient)
+	_, err = client.ListOntologies()
+	assert.NotNil(t, err)
+	assert.NotContains(t, err.Error(), "secret")
+	assert.Contains(t, err.Error(), "apiKey=REDACTED")
+	assertRedactedChain(t, err, "secret")
+	_, ok := errors.Cause(err).(*url.Error)
+	assert.True(t, ok)
+
+	// API errors carry the request
+	scripted := mocks.NewScriptedClient()
+	scripted.On("GET", "sentimentAnalyzerOntologies").Respond(500, "Error")
+	client.WithHTTPClient(scripted)
+	_, err = client.ListOntologies()
+	res := errors.Cause(err).(APIError).Response
+	assert.Equal(t, Redacted, res.Request.URL.Query().Get("apiKey"))
+
+	// No error in the chain mentions the key
+	err = redactError(errors.Wrap(errors.New("bad key secret"), "Error"), "secret")
+	assert.Equal(t, "Error: bad key REDACTED", err.Error())
+	assertRedactedChain(t, err, "secret")
+	assert.Nil(t, redactError(nil, "secret"))
+
+	// Timeouts are still timeouts, even with the key in the inner error
+	err = redactError(&url.Error{Op: "Get", URL: "http://x/?apiKey=secret", Err: keyTimeout{}}, "secret")
+	assertRedactedChain(t, err, "secret")
+	urlErr, ok := err.(*url.Error)
+	if assert.True(t, ok) {
+		assert.True(t, urlErr.Timeout())
+		assert.True(t, urlErr.Temporary())
+	}
+}
+
+// assertRedactedChain asserts that neither err nor any error it wraps mentions
+// key.
+func assertRedactedChain(t *testing.T, err error, key string) {
+	for err != nil {
+		assert.NotContains(t, err.Error(), key)
+		switch wrapper := err.(type) {
+		case *url.Error:
+			err = wrapper.Err
+		case interface{ Cause() error }:
+			err = wrapper.Cause()
+		case interface{ Unwrap() error }:
+			err = wrapper.Unwrap()
+		default:
+			err = nil
+		}
+	}
+}
+
+// keyTimeout is a timeout error that mentions the key.
+type keyTimeout struct{}
+
+func (keyTimeout) Error() string   { return "timeout waiting for apiKey=secret" }
+func (keyTimeout) Timeout() bool   { return true }
+func (keyTimeout) Temporary() bool { return true }
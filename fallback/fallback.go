@@ -0,0 +1,230 @@
+// Package fallback provides composites that call the remote intellexer API
+// first and fall back to a secondary implementation (usually from the local
+// package) when the API is out of quota, rejects the API key, or is failing.
+// A circuit breaker stops the composites from calling the API after repeated
+// failures, and periodically probes it to detect recovery.
+package fallback
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/amccarthy1/intellexer"
+	"github.com/pkg/errors"
+)
+
+// Backend says which backend produced a result.
+type Backend string
+
+// These are the backends a result can come from.
+const (
+	Primary   Backend = "primary"
+	Secondary Backend = "secondary"
+)
+
+// ShouldFallback decides whether an error from the primary backend should
+// cause the secondary backend to be used instead.
+type ShouldFallback func(err error) bool
+
+// DefaultShouldFallback falls back on quota (429), authentication (401, 403)
+// and server (5xx) errors from the API, when the client's own circuit breaker
+// is open, and when the API couldn't be reached at all (timeouts, refused or
+// reset connections, DNS failures, garbled responses). Other client errors
+// from the API and invalid input are returned to the caller, since the
+// secondary backend would most likely fail the same way, and so are requests
+// cancelled by the caller.
+func DefaultShouldFallback(err error) bool {
+	if intellexer.IsLocalError(err) {
+		return false
+	}
+	apiError, ok := errors.Cause(err).(intellexer.APIError)
+	if !ok {
+		return true
+	}
+	switch code := apiError.Response.StatusCode; {
+	case code == http.StatusUnauthorized,
+		code == http.StatusForbidden,
+		code == http.StatusTooManyRequests,
+		code >= 500:
+		return true
+	}
+	return false
+}
+
+// SentimentResult is a sentiment response along with its provenance.
+type SentimentResult struct {
+	*intellexer.SentimentResponse
+	// Backend is the backend that produced the response.
+	Backend Backend
+	// PrimaryErr is the error from the primary backend that caused the
+	// fallback, if any. It is nil if the primary backend was skipped because
+	// the circuit breaker was open.
+	PrimaryErr error
+}
+
+// TopicsResult is a list of topics along with its provenance.
+type TopicsResult struct {
+	Topics []string
+	// Backend is the backend that produced the topics.
+	Backend Backend
+	// PrimaryErr is the error from the primary backend that caused the
+	// fallback, if any.
+	PrimaryErr error
+}
+
+// router holds the logic shared by the composites: whether to try the primary
+// backend, and how to record the outcome.
+type router struct {
+	breaker        *intellexer.CircuitBreaker
+	shouldFallback ShouldFallback
+}
+
+// try calls primary if the breaker allows it. It returns whether the secondary
+// backend should be used, and the primary error (if any).
+func (r *router) try(primary func() error) (bool, error) {
+	if r.breaker != nil && !r.breaker.Allow() {
+		return true, nil
+	}
+	err := primary()
+	if err == nil {
+		if r.breaker != nil {
+			r.breaker.Success()
+		}
+		return false, nil
+	}
+	if !r.shouldFallback(err) {
+		if r.breaker != nil {
+			if _, ok := errors.Cause(err).(intellexer.APIError); ok {
+				// The API is up, it just didn't like this request.
+				r.breaker.Success()
+			} else {
+				// The error says nothing about the API.
+				r.breaker.Release()
+			}
+		}
+		return false, err
+	}
+	if r.breaker != nil {
+		r.breaker.Failure()
+	}
+	return true, err
+}
+
+// Analyzer is a composite sentiment analyzer.
+type Analyzer struct {
+	router
+	primary   intellexer.Analyzer
+	secondary intellexer.Analyzer
+}
+
+var _ intellexer.Analyzer = (*Analyzer)(nil)
+
+// NewAnalyzer returns a composite that calls primary first and secondary on
+// failure. The breaker may be nil, in which case the primary backend is always
+// tried first.
+func NewAnalyzer(primary, secondary intellexer.Analyzer, breaker *intellexer.CircuitBreaker) *Analyzer {
+	return &Analyzer{
+		router:    router{breaker: breaker, shouldFallback: DefaultShouldFallback},
+		primary:   primary,
+		secondary: secondary,
+	}
+}
+
+// WithShouldFallback overrides which errors cause a fallback.
+func (a *Analyzer) WithShouldFallback(shouldFallback ShouldFallback) *Analyzer {
+	a.shouldFallback = shouldFallback
+	return a
+}
+
+// Analyze analyzes the reviews, reporting which backend was used.
+func (a *Analyzer) Analyze(ontology intellexer.Ontology, reviews []intellexer.Review) (SentimentResult, error) {
+	var res *intellexer.SentimentResponse
+	useSecondary, primaryErr := a.try(func() error {
+		var err error
+		res, err = a.primary.AnalyzeSentiments(ontology, reviews)
+		return err
+	})
+	if !useSecondary {
+		if primaryErr != nil {
+			return SentimentResult{}, primaryErr
+		}
+		return SentimentResult{SentimentResponse: res, Backend: Primary}, nil
+	}
+	res, err := a.secondary.AnalyzeSentiments(ontology, reviews)
+	if err != nil {
+		return SentimentResult{}, errors.Wrap(err, "Secondary backend failed")
+	}
+	return SentimentResult{SentimentResponse: res, Backend: Secondary, PrimaryErr: primaryErr}, nil
+}
+
+// AnalyzeSentiments implements intellexer.Analyzer, discarding provenance.
+func (a *Analyzer) AnalyzeSentiments(ontology intellexer.Ontology, reviews []intellexer.Review) (*intellexer.SentimentResponse, error) {
+	res, err := a.Analyze(ontology, reviews)
+	if err != nil {
+		return nil, err
+	}
+	return res.SentimentResponse, nil
+}
+
+// TopicExtractor is a composite topic extractor.
+type TopicExtractor struct {
+	router
+	primary   intellexer.TopicExtractor
+	secondary intellexer.TopicExtractor
+}
+
+var _ intellexer.TopicExtractor = (*TopicExtractor)(nil)
+
+// NewTopicExtractor returns a composite that calls primary first and secondary
+// on failure. The breaker may be nil, in which case the primary backend is
+// always tried first.
+func NewTopicExtractor(primary, secondary intellexer.TopicExtractor, breaker *intellexer.CircuitBreaker) *TopicExtractor {
+	return &TopicExtractor{
+		router:    router{breaker: breaker, shouldFallback: DefaultShouldFallback},
+		primary:   primary,
+		secondary: secondary,
+	}
+}
+
+// WithShouldFallback overrides which errors cause a fallback.
+func (te *TopicExtractor) WithShouldFallback(shouldFallback ShouldFallback) *TopicExtractor {
+	te.shouldFallback = shouldFallback
+	return te
+}
+
+// Extract gets the topics of the document, reporting which backend was used.
+// The document is buffered in memory so it can be sent to both backends.
+func (te *TopicExtractor) Extract(body io.Reader) (TopicsResult, error) {
+	document, err := ioutil.ReadAll(body)
+	if err != nil {
+		return TopicsResult{}, errors.Wrap(err, "Error reading document")
+	}
+	var topics []string
+	useSecondary, primaryErr := te.try(func() error {
+		var err error
+		topics, err = te.primary.GetTopics(bytes.NewReader(document))
+		return err
+	})
+	if !useSecondary {
+		if primaryErr != nil {
+			return TopicsResult{}, primaryErr
+		}
+		return TopicsResult{Topics: topics, Backend: Primary}, nil
+	}
+	topics, err = te.secondary.GetTopics(bytes.NewReader(document))
+	if err != nil {
+		return TopicsResult{}, errors.Wrap(err, "Secondary backend failed")
+	}
+	return TopicsResult{Topics: topics, Backend: Secondary, PrimaryErr: primaryErr}, nil
+}
+
+// GetTopics implements intellexer.TopicExtractor, discarding provenance.
+func (te *TopicExtractor) GetTopics(body io.Reader) ([]string, error) {
+	res, err := te.Extract(body)
+	if err != nil {
+		return nil, err
+	}
+	return res.Topics, nil
+}
@@ -0,0 +1,180 @@
+package fallback
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amccarthy1/intellexer"
+	"github.com/amccarthy1/intellexer/local"
+	"github.com/amccarthy1/intellexer/mocks"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+var reviews = []intellexer.Review{{ID: "1", Text: "I love the coffee"}}
+
+func newRemote(client *mocks.ScriptedClient) *intellexer.Client {
+	return intellexer.NewClient("test").WithBaseURL("FAKEURL").WithHTTPClient(client)
+}
+
+func TestAnalyzerFallback(t *testing.T) {
+	scripted := mocks.NewScriptedClient()
+	scripted.On("POST", "analyzeSentiments").
+		RespondWithFile(200, "../testdata/analyze_sentiments_response.json").
+		Respond(429, "Quota exceeded").
+		Respond(400, "Bad request")
+	analyzer := NewAnalyzer(newRemote(scripted), local.NewAnalyzer(), nil)
+
+	res, err := analyzer.Analyze(intellexer.Restaurants, reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, Primary, res.Backend)
+	assert.Nil(t, res.PrimaryErr)
+	assert.Equal(t, "3fce35a7-b41c-4b75-b564-ec438cc30755", res.Sentiments[0].ID)
+
+	res, err = analyzer.Analyze(intellexer.Restaurants, reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, Secondary, res.Backend)
+	assert.Equal(t, 429, errors.Cause(res.PrimaryErr).(intellexer.APIError).Response.StatusCode)
+	assert.Equal(t, "1", res.Sentiments[0].ID)
+
+	// Client errors are not worth falling back on
+	plain, err := analyzer.AnalyzeSentiments(intellexer.Restaurants, reviews)
+	assert.Nil(t, plain)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Request Error")
+
+	// Custom fallback policy
+	analyzer.WithShouldFallback(func(error) bool { return true })
+	plain, err = analyzer.AnalyzeSentiments(intellexer.Restaurants, reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", plain.Sentiments[0].ID)
+}
+
+func TestAnalyzerCircuitBreaker(t *testing.T) {
+	scripted := mocks.NewScriptedClient()
+	scripted.On("POST", "analyzeSentiments").Respond(503, "Unavailable")
+	breaker := intellexer.NewCircuitBreaker(2, time.Hour)
+	analyzer := NewAnalyzer(newRemote(scripted), local.NewAnalyzer(), breaker)
+
+	for i := 0; i < 5; i++ {
+		res, err := analyzer.Analyze(intellexer.Restaurants, reviews)
+		assert.Nil(t, err)
+		assert.Equal(t, Secondary, res.Backend)
+	}
+	// The breaker opened after two failures and stopped calling the API
+	scripted.AssertCallCount(t, "POST", "analyzeSentiments", 2)
+	assert.Equal(t, intellexer.BreakerOpen, breaker.State())
+}
+
+func TestAnalyzerRecovery(t *testing.T) {
+	scripted := mocks.NewScriptedClient()
+	scripted.On("POST", "analyzeSentiments").
+		Respond(500, "Error").
+		RespondWithFile(200, "../testdata/analyze_sentiments_response.json")
+	// No cooldown, so every call after opening is a probe
+	breaker := intellexer.NewCircuitBreaker(1, 0)
+	analyzer := NewAnalyzer(newRemote(scripted), local.NewAnalyzer(), breaker)
+
+	res, err := analyzer.Analyze(intellexer.Restaurants, reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, Secondary, res.Backend)
+	assert.Equal(t, intellexer.BreakerOpen, breaker.State())
+
+	res, err = analyzer.Analyze(intellexer.Restaurants, reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, Primary, res.Backend)
+	assert.Equal(t, intellexer.BreakerClosed, breaker.State())
+}
+
+func TestSecondaryFailure(t *testing.T) {
+	scripted := mocks.NewScriptedClient()
+	scripted.On("POST", "analyzeSentiments").Respond(401, "Unauthorized")
+	analyzer := NewAnalyzer(newRemote(scripted), local.NewAnalyzer(), nil)
+	_, err := analyzer.Analyze(intellexer.Ontology("cars"), reviews)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Secondary backend failed")
+}
+
+func TestTopicExtractorFallback(t *testing.T) {
+	scripted := mocks.NewScriptedClient()
+	scripted.On("POST", "getTopicsFromFile").
+		Respond(200, `["Remote.topic"]`).
+		Respond(403, "Forbidden")
+	extractor := NewTopicExtractor(newRemote(scripted), local.NewTopicExtractor(), nil)
+
+	res, err := extractor.Extract(strings.NewReader("tech health care"))
+	assert.Nil(t, err)
+	assert.Equal(t, TopicsResult{Topics: []string{"Remote.topic"}, Backend: Primary}, res)
+
+	res, err = extractor.Extract(strings.NewReader("tech health care"))
+	assert.Nil(t, err)
+	assert.Equal(t, Secondary, res.Backend)
+	assert.Equal(t, []string{"Health.healthcare", "Tech.information_technology"}, res.Topics)
+	assert.NotNil(t, res.PrimaryErr)
+
+	// Both backends saw the same document
+	sent := scripted.RequestsTo("POST", "getTopicsFromFile")
+	assert.Equal(t, "tech health care", string(sent[1].Body))
+
+	extractor.WithShouldFallback(func(error) bool { return false })
+	topics, err := extractor.GetTopics(strings.NewReader("tech"))
+	assert.Nil(t, topics)
+	assert.NotNil(t, err)
+}
+
+func TestFallbackOnClientBreaker(t *testing.T) {
+	scripted := mocks.NewScriptedClient()
+	scripted.On("POST", "analyzeSentiments").Respond(400, "Bad request")
+	remote := newRemote(scripted).WithCircuitBreaker(intellexer.BreakerConfig{
+		FailureThreshold: 1,
+		Cooldown:         time.Hour,
+		IsFailure:        func(int) bool { return true },
+	})
+	analyzer := NewAnalyzer(remote, local.NewAnalyzer(), nil)
+	_, err := analyzer.Analyze(intellexer.Restaurants, reviews)
+	assert.NotNil(t, err)
+	res, err := analyzer.Analyze(intellexer.Restaurants, reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, Secondary, res.Backend)
+	assert.Equal(t, intellexer.BreakerOpenError{Endpoint: "analyzeSentiments"}, errors.Cause(res.PrimaryErr))
+}
+
+func TestFallbackOnTransportErrors(t *testing.T) {
+	scripted := mocks.NewScriptedClient()
+	scripted.On("POST", "analyzeSentiments").RespondWithFile(200, "../testdata/analyze_sentiments_response.json")
+	injector := mocks.NewFaultInjector(scripted).WithSequence(mocks.Timeout, mocks.ConnectionReset)
+	remote := intellexer.NewClient("test").WithBaseURL("FAKEURL").WithHTTPClient(injector)
+	breaker := intellexer.NewCircuitBreaker(2, time.Hour)
+	analyzer := NewAnalyzer(remote, local.NewAnalyzer(), breaker)
+
+	res, err := analyzer.Analyze(intellexer.Restaurants, reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, Secondary, res.Backend)
+	timeout, ok := errors.Cause(res.PrimaryErr).(interface{ Timeout() bool })
+	assert.True(t, ok && timeout.Timeout())
+	assert.Equal(t, intellexer.BreakerClosed, breaker.State())
+
+	res, err = analyzer.Analyze(intellexer.Restaurants, reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, Secondary, res.Backend)
+	assert.Contains(t, res.PrimaryErr.Error(), "connection reset")
+	assert.Equal(t, intellexer.BreakerOpen, breaker.State())
+
+	// The breaker keeps the API from being called while it is down
+	res, err = analyzer.Analyze(intellexer.Restaurants, reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, Secondary, res.Backend)
+	assert.Nil(t, res.PrimaryErr)
+	assert.Equal(t, map[mocks.Fault]int{mocks.Timeout: 1, mocks.ConnectionReset: 1}, injector.Injected())
+	scripted.AssertCallCount(t, "POST", "analyzeSentiments", 0)
+}
+
+func TestNoFallbackOnInvalidInput(t *testing.T) {
+	scripted := mocks.NewScriptedClient()
+	breaker := intellexer.NewCircuitBreaker(1, time.Hour)
+	analyzer := NewAnalyzer(newRemote(scripted), local.NewAnalyzer(), breaker)
+	_, err := analyzer.Analyze(intellexer.Restaurants, []intellexer.Review{{Text: "no ID"}})
+	assert.IsType(t, intellexer.ReviewIDError{}, errors.Cause(err))
+	assert.Equal(t, intellexer.BreakerClosed, breaker.State())
+}
@@ -0,0 +1,164 @@
+package intellexer
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// HedgeStats counts how often hedged requests fire and win.
+type HedgeStats struct {
+	// Calls is the number of calls made to hedged endpoints.
+	Calls uint64
+	// Hedged is the number of calls that were slow enough to send a hedge.
+	Hedged uint64
+	// HedgeWins is the number of calls answered by the hedge rather than by the
+	// original request.
+	HedgeWins uint64
+}
+
+// hedger holds the hedging configuration and counters of a Client.
+type hedger struct {
+	delay     time.Duration
+	calls     uint64
+	hedged    uint64
+	hedgeWins uint64
+}
+
+// WithHedging enables hedged requests for AnalyzeSentiments. If a call hasn't
+// completed within delay, a duplicate request is sent, and whichever request
+// succeeds first is used while the other is cancelled. This trades a little
+// extra API usage for a much shorter latency tail. A delay of 0 disables
+// hedging. A good delay is around the p95 latency of the endpoint.
+func (c *Client) WithHedging(delay time.Duration) *Client {
+	if delay <= 0 {
+		c.hedging = nil
+		return c
+	}
+	c.hedging = &hedger{delay: delay}
+	return c
+}
+
+// HedgeStats returns the hedging counters. They are all zero if hedging is not
+// enabled.
+func (c *Client) HedgeStats() HedgeStats {
+	if c.hedging == nil {
+		return HedgeStats{}
+	}
+	return HedgeStats{
+		Calls:     atomic.LoadUint64(&c.hedging.calls),
+		Hedged:    atomic.LoadUint64(&c.hedging.hedged),
+		HedgeWins: atomic.LoadUint64(&c.hedging.hedgeWins),
+	}
+}
+
+type hedgeAttempt struct {
+	res *http.Response
+	err error
+	// index is 0 for the original request and 1 for the hedge.
+	index int
+}
+
+// succeeded reports whether an attempt is good enough to win the race. Client
+// errors (4xx) would be the same for both requests, so they win too.
+func (a hedgeAttempt) succeeded() bool {
+	return a.err == nil && a.res.StatusCode < 500
+}
+
+// doHedged sends req, hedging it if enabled. newRequest must build a fresh
+// copy of req, since a request body can only be sent once.
+func (c *Client) doHedged(req *http.Request, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	if c.hedging == nil {
+		return c.do(req)
+	}
+	atomic.AddUint64(&c.hedging.calls, 1)
+
+	results := make(chan hedgeAttempt, 2)
+	var cancels []context.CancelFunc
+	pending := 0
+	send := func(req *http.Request) {
+		ctx, cancel := context.WithCancel(req.Context())
+		req = req.WithContext(ctx)
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		pending++
+		go func() {
+			res, err := c.do(req)
+			results <- hedgeAttempt{res: res, err: err, index: index}
+		}()
+	}
+	send(req)
+
+	timer := time.NewTimer(c.hedging.delay)
+	defer timer.Stop()
+	timeout := timer.C
+	for {
+		select {
+		case <-timeout:
+			timeout = nil
+			if hedge, err := newRequest(); err == nil {
+				atomic.AddUint64(&c.hedging.hedged, 1)
+				send(hedge.WithContext(req.Context()))
+			}
+		case attempt := <-results:
+			pending--
+			if !attempt.succeeded() && pending > 0 {
+				// The other request might still succeed.
+				discard(attempt.res)
+				cancels[attempt.index]()
+				continue
+			}
+			// Either this attempt won, or it was the last one left. Failures
+			// before the hedge is sent are returned as-is; hedging is for slow
+			// requests, not failing ones.
+			if attempt.succeeded() && attempt.index > 0 {
+				atomic.AddUint64(&c.hedging.hedgeWins, 1)
+			}
+			for i, cancel := range cancels {
+				if i != attempt.index {
+					cancel()
+				}
+			}
+			go drain(results, pending)
+			if attempt.res == nil {
+				cancels[attempt.index]()
+				return nil, attempt.err
+			}
+			// Keep the request alive until its body has been read.
+			attempt.res.Body = cancelOnClose{attempt.res.Body, cancels[attempt.index]}
+			return attempt.res, nil
+		}
+	}
+}
+
+// drain discards the responses of abandoned requests as they come in.
+func drain(results chan hedgeAttempt, pending int) {
+	for i := 0; i < pending; i++ {
+		discard((<-results).res)
+	}
+}
+
+// discard reads what is left of a response body, so the connection can be
+// reused, and closes it. The response may be nil.
+func discard(res *http.Response) {
+	if res == nil {
+		return
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64<<10))
+	res.Body.Close()
+}
+
+// cancelOnClose cancels a request's context once its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,125 @@
+package intellexer
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amccarthy1/intellexer/mocks"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func newHedgingClient(latency time.Duration, faults ...mocks.Fault) (*Client, *mocks.ScriptedClient) {
+	scripted := mocks.NewScriptedClient()
+	scripted.On("POST", "analyzeSentiments").RespondWithFile(200, "testdata/analyze_sentiments_response.json")
+	injector := mocks.NewFaultInjector(scripted).WithLatency(latency).WithSequence(faults...)
+	client := NewClient("test").
+		WithBaseURL("FAKEURL").
+		WithHTTPClient(injector).
+		WithHedging(5 * time.Millisecond)
+	return client, scripted
+}
+
+var hedgeReviews = []Review{{ID: "1", Text: "I love coffee"}}
+
+func TestHedgingNotNeeded(t *testing.T) {
+	client, scripted := newHedgingClient(time.Millisecond)
+	res, err := client.AnalyzeSentiments(Restaurants, hedgeReviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, res.SentimentsCount)
+	assert.Equal(t, HedgeStats{Calls: 1}, client.HedgeStats())
+	scripted.AssertCallCount(t, "POST", "analyzeSentiments", 1)
+}
+
+func TestHedgeWins(t *testing.T) {
+	client, scripted := newHedgingClient(time.Hour, mocks.Delay)
+	start := time.Now()
+	res, err := client.AnalyzeSentiments(Restaurants, hedgeReviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, res.SentimentsCount)
+	assert.True(t, time.Since(start) < time.Minute)
+	assert.Equal(t, HedgeStats{Calls: 1, Hedged: 1, HedgeWins: 1}, client.HedgeStats())
+	// The slow request was cancelled before it got through
+	scripted.AssertCallCount(t, "POST", "analyzeSentiments", 1)
+	sent := scripted.Requests()[0]
+	sent.AssertJSONBody(t, `[{"id":"1","text":"I love coffee"}]`)
+}
+
+func TestHedgeFails(t *testing.T) {
+	client, _ := newHedgingClient(50*time.Millisecond, mocks.Delay, mocks.ConnectionReset)
+	res, err := client.AnalyzeSentiments(Restaurants, hedgeReviews)
+	assert.Nil(t, err)
+	assert.NotNil(t, res)
+	assert.Equal(t, HedgeStats{Calls: 1, Hedged: 1, HedgeWins: 0}, client.HedgeStats())
+}
+
+func TestHedgingFastFailure(t *testing.T) {
+	client, scripted := newHedgingClient(time.Millisecond, mocks.ConnectionReset)
+	_, err := client.AnalyzeSentiments(Restaurants, hedgeReviews)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Request failed")
+	assert.Equal(t, HedgeStats{Calls: 1}, client.HedgeStats())
+	scripted.AssertCallCount(t, "POST", "analyzeSentiments", 0)
+
+	// Both requests fail, so the last failure is returned
+	client, _ = newHedgingClient(50*time.Millisecond, mocks.Timeout, mocks.ConnectionReset)
+	_, err = client.AnalyzeSentiments(Restaurants, hedgeReviews)
+	assert.NotNil(t, err)
+	assert.Equal(t, "mocks: injected timeout", errors.Cause(err).Error())
+	assert.Equal(t, HedgeStats{Calls: 1, Hedged: 1}, client.HedgeStats())
+}
+
+func TestHedgingDisabled(t *testing.T) {
+	client, _ := newHedgingClient(time.Millisecond)
+	client.WithHedging(0)
+	_, err := client.AnalyzeSentiments(Restaurants, hedgeReviews)
+	assert.Nil(t, err)
+	assert.Equal(t, HedgeStats{}, client.HedgeStats())
+}
+
+// httpClientFunc adapts a function to the httpClient interface.
+type httpClientFunc func(req *http.Request) (*http.Response, error)
+
+func (f httpClientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// closeTracker records whether a body was closed.
+type closeTracker struct {
+	io.Reader
+	closed chan struct{}
+}
+
+func (ct closeTracker) Close() error {
+	close(ct.closed)
+	return nil
+}
+
+func TestHedgeLoserBodyClosed(t *testing.T) {
+	loser := closeTracker{strings.NewReader("Unavailable"), make(chan struct{})}
+	var calls int32
+	client := NewClient("test").WithBaseURL("FAKEURL").WithHedging(5 * time.Millisecond).
+		WithHTTPClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				// The original request fails while the hedge is in flight
+				time.Sleep(20 * time.Millisecond)
+				return &http.Response{StatusCode: 503, Body: loser}, nil
+			}
+			time.Sleep(50 * time.Millisecond)
+			body, _ := os.Open("testdata/analyze_sentiments_response.json")
+			return &http.Response{StatusCode: 200, Body: body}, nil
+		}))
+	res, err := client.AnalyzeSentiments(Restaurants, hedgeReviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, res.SentimentsCount)
+	select {
+	case <-loser.closed:
+	default:
+		t.Error("losing response body was not closed")
+	}
+}
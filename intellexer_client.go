@@ -4,11 +4,13 @@ package intellexer
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"path"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -50,9 +52,14 @@ type httpClient interface {
 
 // Client is an intellexer API client
 type Client struct {
-	baseURL string
-	apiKey  string
-	client  httpClient
+	baseURL         string
+	apiKey          string
+	client          httpClient
+	maxDocumentSize int64
+	breakers        *breakerSet
+	hedging         *hedger
+	credentials     CredentialProvider
+	authHeader      string
 }
 
 // APIError is an error returned by the intellexer API. You can retrieve the response object
@@ -73,7 +80,6 @@ type param struct {
 
 func (c *Client) queryString(params ...param) string {
 	qString := url.Values(make(map[string][]string))
-	qString.Add("apiKey", c.apiKey)
 	for _, param := range params {
 		qString.Add(param.key, param.value)
 	}
@@ -89,12 +95,84 @@ func (c *Client) getPath(path string) string {
 	return fmt.Sprintf("%s/%s", url, path)
 }
 
+// nextAPIKey returns the key to use for the next request.
+func (c *Client) nextAPIKey() (string, error) {
+	if c.credentials == nil {
+		return c.apiKey, nil
+	}
+	key, err := c.credentials.APIKey()
+	if err != nil {
+		return "", errors.Wrap(err, "Error getting API key")
+	}
+	return key, nil
+}
+
+// authorize returns a copy of the request with the API key added. The key is
+// added at send time, rather than when the URL is built, so that every attempt
+// can use a fresh key from the credential provider.
+func (c *Client) authorize(req *http.Request) (*http.Request, string, error) {
+	key, err := c.nextAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+	authorized := req.WithContext(req.Context())
+	if len(c.authHeader) > 0 {
+		authorized.Header = cloneHeader(req.Header)
+		authorized.Header.Set(c.authHeader, key)
+		return authorized, key, nil
+	}
+	u := *req.URL
+	query := u.Query()
+	query.Set("apiKey", key)
+	u.RawQuery = query.Encode()
+	authorized.URL = &u
+	return authorized, key, nil
+}
+
+// keyReporter is implemented by credential providers that want to know how the
+// API responded to their keys.
+type keyReporter interface {
+	report(key string, res *http.Response)
+}
+
+// do authorizes and sends a request, going through the circuit breaker for its
+// endpoint if circuit breaking is enabled. The API key is scrubbed from any
+// error returned and from the request attached to the response.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	var breaker *CircuitBreaker
+	if c.breakers != nil {
+		endpoint := path.Base(req.URL.Path)
+		breaker = c.breakers.get(endpoint)
+		if !breaker.Allow() {
+			return nil, BreakerOpenError{endpoint}
+		}
+	}
+	authorized, key, err := c.authorize(req)
+	if err != nil {
+		if breaker != nil {
+			breaker.Release()
+		}
+		return nil, err
+	}
+	res, err := c.client.Do(authorized)
+	if breaker != nil {
+		c.breakers.record(breaker, authorized, res, err)
+	}
+	if reporter, ok := c.credentials.(keyReporter); ok {
+		reporter.report(key, res)
+	}
+	if res != nil {
+		res.Request = c.redactRequest(authorized)
+	}
+	return res, redactError(err, key)
+}
+
 func (c *Client) get(path string) (*http.Response, error) {
 	req, err := http.NewRequest("GET", c.getPath(path), nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "Request creation failed")
 	}
-	res, err := c.client.Do(req)
+	res, err := c.do(req)
 	if err != nil {
 		return nil, errors.Wrap(err, "Request failed")
 	}
@@ -106,12 +184,21 @@ func (c *Client) post(path string, jsonBody interface{}) (*http.Response, error)
 	if err != nil {
 		return nil, errors.Wrap(err, "JSON serialization failed")
 	}
-	req, err := http.NewRequest("POST", c.getPath(path), bytes.NewReader(body))
+	// The request may be sent more than once if hedging is enabled, so it needs
+	// to be rebuildable.
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", c.getPath(path), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Content-Type", "application/json")
+		return req, nil
+	}
+	req, err := newRequest()
 	if err != nil {
 		return nil, errors.Wrap(err, "Request creation failed")
 	}
-	req.Header.Add("Content-Type", "application/json")
-	res, err := c.client.Do(req)
+	res, err := c.doHedged(req, newRequest)
 	if err != nil {
 		return nil, errors.Wrap(err, "Request failed")
 	}
@@ -119,6 +206,7 @@ func (c *Client) post(path string, jsonBody interface{}) (*http.Response, error)
 }
 
 func (c *Client) decodeRes(res *http.Response, out interface{}) error {
+	defer res.Body.Close()
 	decoder := json.NewDecoder(res.Body)
 	if err := decoder.Decode(out); err != nil {
 		return errors.Wrap(err, "Error deserializing response")
@@ -170,23 +258,10 @@ func (c *Client) GetTopicsFromURL(url string) ([]string, error) {
 // GetTopics gets a list of topics from the article read from the body.
 // Note that this will actually cause the remote server to read through and
 // analyze the entire article, which will usually take a few seconds and tends
-// to scale with the size of the article.
+// to scale with the size of the article. Use GetTopicsFromUpload for progress
+// reporting and cancellation.
 func (c *Client) GetTopics(body io.Reader) ([]string, error) {
-	var topics []string
-	url := fmt.Sprintf("%s?%s", getTopicsFromFileEndpoint, c.queryString())
-	req, err := http.NewRequest("POST", c.getPath(url), body)
-	if err != nil {
-		return nil, errors.Wrap(err, "Error creating request")
-	}
-	res, err := c.client.Do(req)
-	if err != nil {
-		return nil, errors.Wrap(err, "Error sending request")
-	}
-	res, err = handleResponseErrorCodes(res)
-	if err != nil {
-		return nil, err
-	}
-	return topics, c.decodeRes(res, &topics)
+	return c.GetTopicsFromUpload(context.Background(), Upload{Body: body})
 }
 
 // GetTopicsFromText is a convenience function to get topics from a string.
@@ -212,7 +287,11 @@ func (c *Client) ListOntologies() ([]Ontology, error) {
 // You should assume this call will take a while. It is a network call to a
 // machine learning-based API, and therefore could have a lot of overhead.
 // Also, take care not to exceed the request size determined by your API level.
+// The reviews are checked with ValidateReviews before anything is sent.
 func (c *Client) AnalyzeSentiments(ontology Ontology, reviews []Review) (*SentimentResponse, error) {
+	if err := ValidateReviews(reviews); err != nil {
+		return nil, errors.Wrap(err, "Invalid reviews")
+	}
 	url := fmt.Sprintf("%s?%s", analyzeSentimentsEndpoint, c.queryString(param{"ontology", string(ontology)}))
 	var sentimentResponse SentimentResponse
 	if err := c.postJSON(url, reviews, &sentimentResponse); err != nil {
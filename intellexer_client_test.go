@@ -1,8 +1,16 @@
 package intellexer
 
 import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/amccarthy1/intellexer/mocks"
 	"github.com/pkg/errors"
@@ -17,7 +25,19 @@ func TestQueryString(t *testing.T) {
 		param{"foo", "bar"},
 		param{"foo2", "bar2"},
 	)
-	assert.Equal(t, "apiKey=test&foo=bar&foo2=bar2", qs)
+	assert.Equal(t, "foo=bar&foo2=bar2", qs)
+}
+
+func TestAuthorize(t *testing.T) {
+	client := NewClient("test")
+	req, err := http.NewRequest("GET", client.getPath("foo?bar=baz"), nil)
+	assert.Nil(t, err)
+	authorized, key, err := client.authorize(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "test", key)
+	assert.Equal(t, "https://api.intellexer.com/foo?apiKey=test&bar=baz", authorized.URL.String())
+	// The original request is untouched
+	assert.Equal(t, "https://api.intellexer.com/foo?bar=baz", req.URL.String())
 }
 
 func TestGetPath(t *testing.T) {
@@ -82,6 +102,17 @@ func TestAnalyzeSentiments(t *testing.T) {
 	assert.NotNil(t, res)
 }
 
+func TestAnalyzeSentimentsInvalidReviews(t *testing.T) {
+	client := mocks.NewErrorClient(errors.New("Should not be called"))
+	apiClient := NewClient("test").WithBaseURL("FAKEURL").WithHTTPClient(client)
+	reviews := []Review{{ID: "42", Text: "foo"}, {ID: "42", Text: "bar"}}
+	res, err := apiClient.AnalyzeSentiments(Restaurants, reviews)
+	assert.Nil(t, res)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Invalid reviews")
+	assert.Equal(t, ReviewIDError{ID: "42", Index: 1}, errors.Cause(err))
+}
+
 func TestAPIErrors(t *testing.T) {
 	client := mocks.NewMockClientFromFile(400, "testdata/content_type_error.xhtml")
 	apiClient := NewClient("test").WithBaseURL("FAKEURL").WithHTTPClient(client)
@@ -138,3 +169,231 @@ func TestInternalErrorStates(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "JSON serialization failed")
 }
+
+func TestFakeServer(t *testing.T) {
+	server := mocks.NewFakeServer("secret")
+	defer server.Close()
+	apiClient := NewClient("secret").WithBaseURL(server.URL).WithHTTPClient(http.DefaultClient)
+
+	topics, err := apiClient.GetTopicsFromText("I'm an article about tech health care")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Health.healthcare", "Tech.information_technology"}, topics)
+
+	topics, err = apiClient.GetTopicsFromURL("http://example.com/football")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Sports.football"}, topics)
+
+	ontologies, err := apiClient.ListOntologies()
+	assert.Nil(t, err)
+	assert.Equal(t, []Ontology{"Hotels", "Restaurants", "Gadgets"}, ontologies)
+
+	author := "jdoe"
+	res, err := apiClient.AnalyzeSentiments(Hotels, []Review{
+		{ID: "1", Text: "I love this hotel, great pool", Author: author},
+		{ID: "2", Text: "Terrible service"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, res.SentimentsCount)
+	assert.Equal(t, Hotels, res.Ontology)
+	assert.Equal(t, "1", res.Sentiments[0].ID)
+	assert.Equal(t, 5.0, res.Sentiments[0].SentimentWeight)
+	assert.Equal(t, author, *res.Sentiments[0].Author)
+	assert.Equal(t, -3.0, res.Sentiments[1].SentimentWeight)
+	assert.Nil(t, res.Sentiments[1].Author)
+	assert.Equal(t, `I <pos w="3">love</pos> this hotel, <pos w="2">great</pos> pool`, res.Sentences[0].Text)
+	assert.Len(t, res.Opinions.Children, 3)
+}
+
+func TestFakeServerErrors(t *testing.T) {
+	server := mocks.NewFakeServer("secret")
+	defer server.Close()
+
+	apiClient := NewClient("wrong").WithBaseURL(server.URL).WithHTTPClient(http.DefaultClient)
+	_, err := apiClient.ListOntologies()
+	assert.NotNil(t, err)
+	assert.Equal(t, 401, errors.Cause(err).(APIError).Response.StatusCode)
+
+	apiClient = NewClient("secret").WithBaseURL(server.URL).WithHTTPClient(http.DefaultClient)
+	_, err = apiClient.AnalyzeSentiments(Ontology("cars"), []Review{{ID: "1", Text: "neat"}})
+	assert.NotNil(t, err)
+	assert.Equal(t, 400, errors.Cause(err).(APIError).Response.StatusCode)
+
+	_, err = apiClient.GetTopicsFromURL("")
+	assert.NotNil(t, err)
+	assert.Equal(t, 400, errors.Cause(err).(APIError).Response.StatusCode)
+}
+
+func TestScriptedClient(t *testing.T) {
+	client := mocks.NewScriptedClient()
+	client.On("POST", "analyzeSentiments").
+		WithQuery("ontology", "hotels").
+		Respond(500, "oops").
+		RespondWithFile(200, "testdata/analyze_sentiments_response.json")
+	client.On("POST", "analyzeSentiments").Fail(errors.New("wrong ontology"))
+	client.On("GET", "/sentimentAnalyzerOntologies").Respond(200, `["Hotels"]`)
+	apiClient := NewClient("test").WithBaseURL("FAKEURL").WithHTTPClient(client)
+
+	reviews := []Review{{ID: "1", Text: "Nice room"}}
+	_, err := apiClient.AnalyzeSentiments(Hotels, reviews)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Server Error")
+	res, err := apiClient.AnalyzeSentiments(Hotels, reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, res.SentimentsCount)
+	_, err = apiClient.AnalyzeSentiments(Gadgets, reviews)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "wrong ontology")
+	_, err = apiClient.ListOntologies()
+	assert.Nil(t, err)
+	_, err = apiClient.GetTopicsFromURL("http://example.com")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "No scripted response for GET")
+
+	assert.Len(t, client.Requests(), 5)
+	client.AssertCallCount(t, "POST", "analyzeSentiments", 3)
+	client.AssertCallCount(t, "GET", "sentimentAnalyzerOntologies", 1)
+	client.AssertAllConsumed(t)
+	sent := client.RequestsTo("POST", "analyzeSentiments")
+	sent[0].AssertQuery(t, "ontology", "hotels")
+	sent[0].AssertQuery(t, "apiKey", "test")
+	sent[2].AssertQuery(t, "ontology", "gadgets")
+	sent[0].AssertJSONBody(t, `[{"id":"1","text":"Nice room"}]`)
+
+	// Failed assertions are reported to the TestingT
+	mockT := new(testing.T)
+	assert.False(t, client.AssertCallCount(mockT, "GET", "getTopicsFromUrl", 0))
+	unused := mocks.NewScriptedClient()
+	unused.On("GET", "foo").Respond(200, "")
+	assert.False(t, unused.AssertAllConsumed(mockT))
+}
+
+func TestRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassettes")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	server := mocks.NewFakeServer("secret")
+	defer server.Close()
+
+	recorder := mocks.NewRecorder(dir, mocks.Record, http.DefaultClient)
+	apiClient := NewClient("secret").WithBaseURL(server.URL).WithHTTPClient(recorder)
+	reviews := []Review{{ID: "1", Text: "I love it"}}
+	recorded, err := apiClient.AnalyzeSentiments(Gadgets, reviews)
+	assert.Nil(t, err)
+	topics, err := apiClient.GetTopicsFromText("tech")
+	assert.Nil(t, err)
+
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 2)
+	for _, file := range files {
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		assert.Nil(t, err)
+		assert.NotContains(t, string(data), "secret")
+		assert.Contains(t, string(data), "apiKey=REDACTED")
+	}
+
+	// Replay with a different key and no server
+	server.Close()
+	replayer := mocks.NewRecorder(dir, mocks.Replay, nil)
+	apiClient = NewClient("other").WithBaseURL(server.URL).WithHTTPClient(replayer)
+	replayed, err := apiClient.AnalyzeSentiments(Gadgets, reviews)
+	assert.Nil(t, err)
+	assert.Equal(t, recorded, replayed)
+	replayedTopics, err := apiClient.GetTopicsFromText("tech")
+	assert.Nil(t, err)
+	assert.Equal(t, topics, replayedTopics)
+
+	// Different body or query doesn't match
+	_, err = apiClient.AnalyzeSentiments(Hotels, reviews)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "No recorded interaction for POST")
+	_, err = apiClient.GetTopicsFromText("health")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "re-run in Record mode")
+}
+
+func TestFaultInjector(t *testing.T) {
+	scripted := mocks.NewScriptedClient()
+	scripted.On("GET", "sentimentAnalyzerOntologies").Respond(200, `["Hotels","Restaurants","Gadgets"]`)
+	injector := mocks.NewFaultInjector(scripted).
+		WithLatency(time.Millisecond).
+		WithRetryAfter(30*time.Second).
+		WithSequence(
+			mocks.Delay,
+			mocks.Timeout,
+			mocks.ConnectionReset,
+			mocks.PartialBody,
+			mocks.RateLimited,
+			mocks.HTMLErrorPage,
+			mocks.NoFault,
+		)
+	apiClient := NewClient("test").WithBaseURL("FAKEURL").WithHTTPClient(injector)
+
+	ontologies, err := apiClient.ListOntologies()
+	assert.Nil(t, err)
+	assert.Len(t, ontologies, 3)
+
+	_, err = apiClient.ListOntologies()
+	assert.NotNil(t, err)
+	timeout, ok := errors.Cause(err).(interface{ Timeout() bool })
+	assert.True(t, ok && timeout.Timeout())
+
+	_, err = apiClient.ListOntologies()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "connection reset")
+	opErr, ok := errors.Cause(err).(*net.OpError)
+	if assert.True(t, ok) {
+		syscallErr, ok := opErr.Err.(*os.SyscallError)
+		assert.True(t, ok && syscallErr.Err == syscall.ECONNRESET)
+	}
+
+	_, err = apiClient.ListOntologies()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Error deserializing response")
+
+	_, err = apiClient.ListOntologies()
+	assert.NotNil(t, err)
+	apiError := errors.Cause(err).(APIError)
+	assert.Equal(t, 429, apiError.Response.StatusCode)
+	assert.Equal(t, "30", apiError.Response.Header.Get("Retry-After"))
+
+	_, err = apiClient.ListOntologies()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Error deserializing response")
+
+	_, err = apiClient.ListOntologies()
+	assert.Nil(t, err)
+	// Only 3 requests made it through to the wrapped client
+	scripted.AssertCallCount(t, "GET", "sentimentAnalyzerOntologies", 3)
+	assert.Equal(t, 1, injector.Injected()[mocks.RateLimited])
+	assert.Equal(t, 0, injector.Injected()[mocks.NoFault])
+}
+
+func TestFaultInjectorProbabilistic(t *testing.T) {
+	run := func(seed int64) map[mocks.Fault]int {
+		scripted := mocks.NewScriptedClient()
+		scripted.On("GET", "sentimentAnalyzerOntologies").Respond(200, `[]`)
+		injector := mocks.NewFaultInjector(scripted).
+			WithSeed(seed).
+			WithProbability(mocks.ConnectionReset, 0.5)
+		apiClient := NewClient("test").WithBaseURL("FAKEURL").WithHTTPClient(injector)
+		for i := 0; i < 100; i++ {
+			apiClient.ListOntologies()
+		}
+		return injector.Injected()
+	}
+	first := run(42)
+	assert.True(t, first[mocks.ConnectionReset] > 20 && first[mocks.ConnectionReset] < 80)
+	assert.Equal(t, first, run(42), "the same seed should inject the same faults")
+}
+
+func TestFaultInjectorDelayCancellation(t *testing.T) {
+	injector := mocks.NewFaultInjector(mocks.NewMockClient(200, "[]")).
+		WithLatency(time.Hour).
+		WithSequence(mocks.Delay)
+	apiClient := NewClient("test").WithBaseURL("FAKEURL").WithHTTPClient(injector)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err := apiClient.GetTopicsFromUpload(ctx, Upload{Body: strings.NewReader("foo")})
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+}
@@ -0,0 +1,22 @@
+package intellexer
+
+import (
+	"io"
+)
+
+// Analyzer analyzes reviews for sentiment. It is implemented by Client, which
+// calls the remote API, and by the local package, which works offline.
+type Analyzer interface {
+	AnalyzeSentiments(ontology Ontology, reviews []Review) (*SentimentResponse, error)
+}
+
+var _ Analyzer = (*Client)(nil)
+
+// TopicExtractor extracts topics from a document, returned in the dotted
+// "Category.subcategory" format used by the API, e.g. "Health.healthcare". It
+// is implemented by Client and by the local package.
+type TopicExtractor interface {
+	GetTopics(body io.Reader) ([]string, error)
+}
+
+var _ TopicExtractor = (*Client)(nil)
@@ -0,0 +1,212 @@
+package intellexer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultKeyCooldown is how long a key is taken out of rotation after the API
+// rejects it, unless configured otherwise.
+const defaultKeyCooldown = time.Minute
+
+// ErrNoAvailableKeys is returned when every key in a KeyPool has been taken out
+// of rotation or has used up its quota.
+var ErrNoAvailableKeys = errors.New("No API keys available")
+
+// KeyStrategy decides which key a KeyPool hands out next.
+type KeyStrategy int
+
+const (
+	// RoundRobin cycles through the available keys in order.
+	RoundRobin KeyStrategy = iota
+	// MostRemaining picks the available key with the most quota remaining.
+	// Keys without a quota are treated as having unlimited quota, and ties go
+	// to the key that has sent the fewest requests.
+	MostRemaining
+)
+
+// KeyUsage is a snapshot of the usage counters of one key in a KeyPool. It
+// identifies the key without including it, so it is safe to log.
+type KeyUsage struct {
+	// Index is the position of the key in the pool.
+	Index int
+	// Fingerprint is a short hash of the key, to tell keys apart across pools.
+	Fingerprint string
+	// Requests is the number of requests sent with this key.
+	Requests int64
+	// Rejections is the number of times the API rejected this key with a 401,
+	// 403 or 429.
+	Rejections int64
+	// Remaining is the quota remaining, or -1 if the key has no quota.
+	Remaining int64
+	// Available is false while the key is out of rotation.
+	Available bool
+}
+
+type pooledKey struct {
+	key        string
+	quota      int64
+	requests   int64
+	rejections int64
+	benchUntil time.Time
+}
+
+func (k *pooledKey) remaining() int64 {
+	if k.quota <= 0 {
+		return math.MaxInt64
+	}
+	return k.quota - k.requests
+}
+
+// KeyPool shares requests between several API keys. Keys that the API rejects
+// with a 401, 403 or 429 are taken out of rotation for a cooldown period. It is
+// safe for concurrent use.
+type KeyPool struct {
+	strategy KeyStrategy
+	cooldown time.Duration
+	now      func() time.Time
+
+	mu   sync.Mutex
+	keys []*pooledKey
+	next int
+}
+
+// NewKeyPool returns a pool of the given keys using the given strategy.
+func NewKeyPool(strategy KeyStrategy, keys ...string) *KeyPool {
+	pool := &KeyPool{
+		strategy: strategy,
+		cooldown: defaultKeyCooldown,
+		now:      time.Now,
+	}
+	for _, key := range keys {
+		pool.keys = append(pool.keys, &pooledKey{key: key})
+	}
+	return pool
+}
+
+// WithQuota sets the number of requests a key may make. Keys that have used
+// up their quota are no longer handed out. Keys have no quota by default.
+func (p *KeyPool) WithQuota(key string, quota int64) *KeyPool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, k := range p.keys {
+		if k.key == key {
+			k.quota = quota
+		}
+	}
+	return p
+}
+
+// WithCooldown sets how long a rejected key is out of rotation. Default 1m.
+func (p *KeyPool) WithCooldown(cooldown time.Duration) *KeyPool {
+	p.cooldown = cooldown
+	return p
+}
+
+// Key returns the next key to use and counts a request against it.
+func (p *KeyPool) Key() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	var chosen *pooledKey
+	switch p.strategy {
+	case MostRemaining:
+		for _, k := range p.keys {
+			if !p.available(k, now) {
+				continue
+			}
+			if chosen == nil || k.remaining() > chosen.remaining() ||
+				k.remaining() == chosen.remaining() && k.requests < chosen.requests {
+				chosen = k
+			}
+		}
+	default:
+		for i := range p.keys {
+			k := p.keys[(p.next+i)%len(p.keys)]
+			if p.available(k, now) {
+				chosen = k
+				p.next = (p.next + i + 1) % len(p.keys)
+				break
+			}
+		}
+	}
+	if chosen == nil {
+		return "", ErrNoAvailableKeys
+	}
+	chosen.requests++
+	return chosen.key, nil
+}
+
+func (p *KeyPool) available(k *pooledKey, now time.Time) bool {
+	return !now.Before(k.benchUntil) && k.remaining() > 0
+}
+
+// report takes a key out of rotation if the API rejected it.
+func (p *KeyPool) report(key string, res *http.Response) {
+	if res == nil {
+		return
+	}
+	switch res.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+	default:
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, k := range p.keys {
+		if k.key == key {
+			k.rejections++
+			k.benchUntil = p.now().Add(p.cooldown)
+		}
+	}
+}
+
+// Usage returns the usage counters of every key in the pool, in the order the
+// keys were added.
+func (p *KeyPool) Usage() []KeyUsage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	usage := make([]KeyUsage, 0, len(p.keys))
+	for i, k := range p.keys {
+		remaining := int64(-1)
+		if k.quota > 0 {
+			remaining = k.remaining()
+		}
+		usage = append(usage, KeyUsage{
+			Index:       i,
+			Fingerprint: KeyFingerprint(k.key),
+			Requests:    k.requests,
+			Rejections:  k.rejections,
+			Remaining:   remaining,
+			Available:   p.available(k, now),
+		})
+	}
+	return usage
+}
+
+// KeyFingerprint returns the first 8 hex digits of the SHA-256 of key, which
+// identifies it in logs without revealing it.
+func KeyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:4])
+}
+
+// APIKey implements CredentialProvider, so a pool can be passed to
+// WithCredentials. It is the same as Key.
+func (p *KeyPool) APIKey() (string, error) {
+	return p.Key()
+}
+
+// WithKeyPool makes the client take its API key from a pool on every request,
+// instead of using the key it was created with. It is shorthand for
+// WithCredentials(pool).
+func (c *Client) WithKeyPool(pool *KeyPool) *Client {
+	return c.WithCredentials(pool)
+}
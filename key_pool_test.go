@@ -0,0 +1,104 @@
+package intellexer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/amccarthy1/intellexer/mocks"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyPoolRoundRobin(t *testing.T) {
+	pool := NewKeyPool(RoundRobin, "a", "b", "c")
+	var keys []string
+	for i := 0; i < 4; i++ {
+		key, err := pool.Key()
+		assert.Nil(t, err)
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "a"}, keys)
+	assert.Equal(t, int64(2), pool.Usage()[0].Requests)
+	assert.Equal(t, int64(-1), pool.Usage()[0].Remaining)
+}
+
+func TestKeyPoolMostRemaining(t *testing.T) {
+	pool := NewKeyPool(MostRemaining, "a", "b").WithQuota("a", 3).WithQuota("b", 2)
+	var keys []string
+	for i := 0; i < 5; i++ {
+		key, err := pool.Key()
+		assert.Nil(t, err)
+		keys = append(keys, key)
+	}
+	// a has more quota, then they tie and alternate
+	assert.Equal(t, []string{"a", "b", "a", "b", "a"}, keys)
+	_, err := pool.Key()
+	assert.Equal(t, ErrNoAvailableKeys, err)
+	assert.Equal(t, []KeyUsage{
+		{Index: 0, Fingerprint: KeyFingerprint("a"), Requests: 3, Remaining: 0, Available: false},
+		{Index: 1, Fingerprint: KeyFingerprint("b"), Requests: 2, Remaining: 0, Available: false},
+	}, pool.Usage())
+
+	// Keys without quota are preferred over keys with quota
+	pool = NewKeyPool(MostRemaining, "limited", "unlimited").WithQuota("limited", 100)
+	key, err := pool.Key()
+	assert.Nil(t, err)
+	assert.Equal(t, "unlimited", key)
+
+	// Keys without quota share the load
+	pool = NewKeyPool(MostRemaining, "a", "b", "c")
+	keys = nil
+	for i := 0; i < 6; i++ {
+		key, err := pool.Key()
+		assert.Nil(t, err)
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "a", "b", "c"}, keys)
+}
+
+func TestKeyPoolUsageHidesKeys(t *testing.T) {
+	pool := NewKeyPool(RoundRobin, "secret-one", "secret-two")
+	pool.Key()
+	usage := pool.Usage()
+	assert.Equal(t, 1, usage[1].Index)
+	assert.Len(t, usage[0].Fingerprint, 8)
+	assert.NotEqual(t, usage[0].Fingerprint, usage[1].Fingerprint)
+	assert.NotContains(t, fmt.Sprintf("%+v", usage), "secret")
+}
+
+func TestKeyPoolRejections(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	pool := NewKeyPool(RoundRobin, "good", "bad").WithCooldown(time.Minute)
+	pool.now = clock.Now
+
+	scripted := mocks.NewScriptedClient()
+	scripted.On("GET", "sentimentAnalyzerOntologies").WithQuery("apiKey", "bad").Respond(429, "Quota exceeded")
+	scripted.On("GET", "sentimentAnalyzerOntologies").WithQuery("apiKey", "good").Respond(200, `["Hotels"]`)
+	client := NewClient("unused").WithBaseURL("FAKEURL").WithHTTPClient(scripted).WithKeyPool(pool)
+
+	for i := 0; i < 4; i++ {
+		client.ListOntologies()
+	}
+	// "bad" was only tried once, then taken out of rotation
+	var keys []string
+	for _, req := range scripted.Requests() {
+		keys = append(keys, req.URL.Query().Get("apiKey"))
+	}
+	assert.Equal(t, []string{"good", "bad", "good", "good"}, keys)
+	usage := pool.Usage()
+	assert.Equal(t, KeyUsage{Index: 1, Fingerprint: KeyFingerprint("bad"), Requests: 1, Rejections: 1, Remaining: -1, Available: false}, usage[1])
+	assert.Equal(t, int64(3), usage[0].Requests)
+
+	// Back in rotation after the cooldown
+	clock.Advance(time.Minute)
+	assert.True(t, pool.Usage()[1].Available)
+
+	// Requests fail once every key is out of rotation
+	pool = NewKeyPool(RoundRobin, "bad")
+	client.WithKeyPool(pool)
+	client.ListOntologies()
+	_, err := client.ListOntologies()
+	assert.Equal(t, ErrNoAvailableKeys, errors.Cause(err))
+	assert.Len(t, scripted.Requests(), 5)
+}
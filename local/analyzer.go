@@ -0,0 +1,290 @@
+// Package local provides offline implementations of the intellexer API
+// endpoints, for use as a fallback when the API quota is exhausted, in
+// air-gapped environments, and in tests. The results are produced with small
+// built-in lexicons, so they are much less accurate than the remote API, but
+// they have the same shape.
+package local
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/amccarthy1/intellexer"
+	"github.com/pkg/errors"
+)
+
+// negationFactor scales the weight of a negated opinion word after its sign is
+// flipped, since "not good" is weaker than "bad".
+const negationFactor = 0.75
+
+// Analyzer is a lexicon-based sentiment analyzer supporting the built-in
+// Hotels, Restaurants and Gadgets ontologies.
+type Analyzer struct {
+	indexes map[string]aspectIndex
+}
+
+var _ intellexer.Analyzer = (*Analyzer)(nil)
+
+// NewAnalyzer returns a local analyzer.
+func NewAnalyzer() *Analyzer {
+	indexes := make(map[string]aspectIndex, len(ontologies))
+	for ontology, categories := range ontologies {
+		indexes[strings.ToLower(string(ontology))] = buildAspectIndex(categories)
+	}
+	return &Analyzer{indexes: indexes}
+}
+
+// opinion is an opinion word found in a sentence, and the aspect it is about.
+type opinion struct {
+	category string
+	aspect   string
+	text     string
+	weight   float64
+	start    int
+	end      int
+}
+
+// AnalyzeSentiments analyzes the reviews for sentiment. Each review's weight is
+// the average weight of its sentences, and each sentence's weight is the sum
+// of the weights of the opinion words in it. Opinion words are attributed to
+// the nearest aspect term in the same sentence, or to the "Other" category if
+// there is none.
+func (a *Analyzer) AnalyzeSentiments(ontology intellexer.Ontology, reviews []intellexer.Review) (*intellexer.SentimentResponse, error) {
+	if err := intellexer.ValidateReviews(reviews); err != nil {
+		return nil, errors.Wrap(err, "Invalid reviews")
+	}
+	name := strings.ToLower(string(ontology))
+	index, ok := a.indexes[name]
+	if !ok {
+		return nil, errors.Errorf("Unsupported ontology %q", ontology)
+	}
+
+	res := &intellexer.SentimentResponse{
+		SentimentsCount: len(reviews),
+		Ontology:        intellexer.Ontology(name),
+	}
+	tree := newOpinionTree()
+	sentenceNum := 0
+	for _, review := range reviews {
+		sentences := splitSentences(review.Text)
+		var total float64
+		for _, s := range sentences {
+			sentenceNum++
+			opinions := analyzeSentence(s, index)
+			var weight float64
+			for _, o := range opinions {
+				weight += o.weight
+				tree.add(o, sentenceNum)
+			}
+			total += weight
+			res.Sentences = append(res.Sentences, intellexer.Sentence{
+				SentimentID:     review.ID,
+				Text:            annotate(s.text, opinions),
+				SentimentWeight: weight,
+			})
+		}
+		sentiment := intellexer.Sentiment{
+			ID:       review.ID,
+			Datetime: review.Datetime,
+		}
+		if len(sentences) > 0 {
+			sentiment.SentimentWeight = total / float64(len(sentences))
+		}
+		if len(review.Author) > 0 {
+			author := review.Author
+			sentiment.Author = &author
+		}
+		if len(review.Title) > 0 {
+			title := review.Title
+			sentiment.Title = &title
+		}
+		res.Sentiments = append(res.Sentiments, sentiment)
+	}
+	res.Opinions = tree.build()
+	return res, nil
+}
+
+func analyzeSentence(s sentence, index aspectIndex) []opinion {
+	var opinions []opinion
+	var aspects []int
+	for i, tok := range s.tokens {
+		if _, ok := index[tok.word]; ok {
+			aspects = append(aspects, i)
+		}
+	}
+	for i, tok := range s.tokens {
+		weight, ok := sentimentWords[tok.word]
+		if !ok {
+			continue
+		}
+		text := tok.word
+		if i > 0 {
+			if factor, ok := intensifiers[s.tokens[i-1].word]; ok {
+				weight *= factor
+			}
+		}
+		for j := i - 1; j >= 0 && j >= i-negationWindow; j-- {
+			if negators[s.tokens[j].word] {
+				weight = -weight * negationFactor
+				text = "not " + text
+				break
+			}
+		}
+		o := opinion{
+			category: otherCategory,
+			aspect:   generalAspect,
+			text:     text,
+			weight:   weight,
+			start:    tok.start,
+			end:      tok.end,
+		}
+		if nearest := nearestAspect(i, aspects); nearest >= 0 {
+			o.aspect = s.tokens[nearest].word
+			o.category = index[o.aspect]
+		}
+		opinions = append(opinions, o)
+	}
+	return opinions
+}
+
+// nearestAspect returns the index of the aspect token closest to position i,
+// preferring the earlier one on ties, or -1 if there are none.
+func nearestAspect(i int, aspects []int) int {
+	nearest, best := -1, 0
+	for _, a := range aspects {
+		distance := a - i
+		if distance < 0 {
+			distance = -distance
+		}
+		if nearest < 0 || distance < best {
+			nearest, best = a, distance
+		}
+	}
+	return nearest
+}
+
+// annotate wraps each opinion word in the sentence in <pos> or <neg> tags, the
+// same way the remote API annotates sentences.
+func annotate(text string, opinions []opinion) string {
+	var b strings.Builder
+	last := 0
+	for _, o := range opinions {
+		tag := "pos"
+		if o.weight < 0 {
+			tag = "neg"
+		}
+		b.WriteString(text[last:o.start])
+		fmt.Fprintf(&b, `<%s w="%g">%s</%s>`, tag, o.weight, text[o.start:o.end], tag)
+		last = o.end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// opinionTree accumulates opinions into the category -> aspect -> opinion word
+// hierarchy used by the remote API.
+type opinionTree map[string]aspectLeaves
+
+// aspectLeaves maps aspect terms to the opinion words about them.
+type aspectLeaves map[string]leaves
+
+// leaves maps opinion words to their accumulated weights.
+type leaves map[string]*leaf
+
+type leaf struct {
+	total     float64
+	count     int
+	sentences []int
+}
+
+func newOpinionTree() opinionTree {
+	return make(opinionTree)
+}
+
+func (t opinionTree) add(o opinion, sentenceNum int) {
+	aspects, ok := t[o.category]
+	if !ok {
+		aspects = make(aspectLeaves)
+		t[o.category] = aspects
+	}
+	words, ok := aspects[o.aspect]
+	if !ok {
+		words = make(leaves)
+		aspects[o.aspect] = words
+	}
+	l, ok := words[o.text]
+	if !ok {
+		l = &leaf{}
+		words[o.text] = l
+	}
+	l.total += o.weight
+	l.count++
+	l.sentences = append(l.sentences, sentenceNum)
+}
+
+// build converts the tree into Opinions, sorted alphabetically at each level so
+// the output is deterministic.
+func (t opinionTree) build() intellexer.Opinion {
+	root := newOpinion(nil)
+	for _, categoryName := range t.keys() {
+		category := newOpinion(stringPtr(categoryName))
+		aspects := t[categoryName]
+		for _, aspectName := range aspects.keys() {
+			aspect := newOpinion(stringPtr(aspectName))
+			words := aspects[aspectName]
+			for _, text := range words.keys() {
+				l := words[text]
+				node := newOpinion(stringPtr(text))
+				node.F = l.count
+				node.RS = l.sentences
+				node.SentimentWeight = l.total / float64(l.count)
+				aspect.Children = append(aspect.Children, node)
+				aspect.F += l.count
+			}
+			category.Children = append(category.Children, aspect)
+			category.F++
+		}
+		root.Children = append(root.Children, category)
+	}
+	return root
+}
+
+func (t opinionTree) keys() []string {
+	keys := make([]string, 0, len(t))
+	for key := range t {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (a aspectLeaves) keys() []string {
+	keys := make([]string, 0, len(a))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (l leaves) keys() []string {
+	keys := make([]string, 0, len(l))
+	for key := range l {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func newOpinion(text *string) intellexer.Opinion {
+	return intellexer.Opinion{
+		Children: []intellexer.Opinion{},
+		RS:       []int{},
+		Text:     text,
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,86 @@
+package local
+
+import (
+	"testing"
+	"time"
+
+	"github.com/amccarthy1/intellexer"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzeSentiments(t *testing.T) {
+	analyzer := NewAnalyzer()
+	dt := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	res, err := analyzer.AnalyzeSentiments(intellexer.Ontology("Restaurants"), []intellexer.Review{
+		{ID: "1", Text: "I love the coffee. The waiter was very rude!", Author: "jdoe", Datetime: &dt},
+		{ID: "2", Text: "Delicious and subtle"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, res.SentimentsCount)
+	assert.Equal(t, intellexer.Restaurants, res.Ontology)
+
+	assert.Len(t, res.Sentiments, 2)
+	assert.Equal(t, "1", res.Sentiments[0].ID)
+	assert.InDelta(t, (2.8-5.25)/2, res.Sentiments[0].SentimentWeight, 0.0001)
+	assert.Equal(t, "jdoe", *res.Sentiments[0].Author)
+	assert.Equal(t, &dt, res.Sentiments[0].Datetime)
+	assert.Nil(t, res.Sentiments[0].Title)
+	assert.InDelta(t, 7.6, res.Sentiments[1].SentimentWeight, 0.0001)
+
+	assert.Len(t, res.Sentences, 3)
+	assert.Equal(t, intellexer.Sentence{
+		SentimentID:     "1",
+		Text:            `I <pos w="2.8">love</pos> the coffee.`,
+		SentimentWeight: 2.8,
+	}, res.Sentences[0])
+	assert.Equal(t, `The waiter was very <neg w="-5.25">rude</neg>!`, res.Sentences[1].Text)
+	assert.Equal(t, "2", res.Sentences[2].SentimentID)
+
+	// Drinks -> coffee -> love, Other -> general -> (delicious, subtle), Service -> waiter -> rude
+	root := res.Opinions
+	assert.Nil(t, root.Text)
+	assert.Len(t, root.Children, 3)
+	drinks := root.Children[0]
+	assert.Equal(t, "Drinks", *drinks.Text)
+	assert.Equal(t, "coffee", *drinks.Children[0].Text)
+	love := drinks.Children[0].Children[0]
+	assert.Equal(t, "love", *love.Text)
+	assert.Equal(t, 2.8, love.SentimentWeight)
+	assert.Equal(t, []int{1}, love.RS)
+	other := root.Children[1]
+	assert.Equal(t, "Other", *other.Text)
+	assert.Equal(t, 2, other.Children[0].F)
+	assert.Equal(t, []int{3}, other.Children[0].Children[0].RS)
+	service := root.Children[2]
+	assert.Equal(t, "Service", *service.Text)
+	assert.Equal(t, "waiter", *service.Children[0].Text)
+}
+
+func TestNegation(t *testing.T) {
+	res, err := NewAnalyzer().AnalyzeSentiments(intellexer.Gadgets, []intellexer.Review{
+		{ID: "1", Text: "The battery is not good"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, -1.5, res.Sentiments[0].SentimentWeight)
+	assert.Equal(t, `The battery is not <neg w="-1.5">good</neg>`, res.Sentences[0].Text)
+	leaf := res.Opinions.Children[0].Children[0].Children[0]
+	assert.Equal(t, "Battery", *res.Opinions.Children[0].Text)
+	assert.Equal(t, "not good", *leaf.Text)
+}
+
+func TestAnalyzeSentimentsErrors(t *testing.T) {
+	analyzer := NewAnalyzer()
+	_, err := analyzer.AnalyzeSentiments(intellexer.Ontology("cars"), []intellexer.Review{{ID: "1"}})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `Unsupported ontology "cars"`)
+
+	_, err = analyzer.AnalyzeSentiments(intellexer.Hotels, []intellexer.Review{{ID: "1"}, {ID: "1"}})
+	assert.NotNil(t, err)
+	assert.Equal(t, intellexer.ReviewIDError{ID: "1", Index: 1}, errors.Cause(err))
+
+	res, err := analyzer.AnalyzeSentiments(intellexer.Hotels, []intellexer.Review{{ID: "1", Text: ""}})
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, res.Sentiments[0].SentimentWeight)
+	assert.Empty(t, res.Opinions.Children)
+}
@@ -0,0 +1,151 @@
+package local
+
+import (
+	"github.com/amccarthy1/intellexer"
+)
+
+// sentimentWords are the opinion words the analyzer recognizes and their
+// weights, on roughly the same scale the remote API uses.
+var sentimentWords = map[string]float64{
+	// positive
+	"amazing":     4.5,
+	"awesome":     4.5,
+	"beautiful":   3.5,
+	"best":        4,
+	"clean":       2.5,
+	"comfortable": 3,
+	"cozy":        2.5,
+	"delicious":   4.95,
+	"excellent":   4.5,
+	"fantastic":   4.5,
+	"fast":        2,
+	"fresh":       2.5,
+	"friendly":    3,
+	"good":        2,
+	"great":       3.5,
+	"happy":       3,
+	"helpful":     3,
+	"like":        1.5,
+	"love":        2.8,
+	"loved":       2.8,
+	"neat":        2,
+	"nice":        2,
+	"perfect":     4.5,
+	"pleasant":    2.5,
+	"quiet":       2,
+	"recommend":   3,
+	"reliable":    3,
+	"responsive":  2.5,
+	"sharp":       2,
+	"spacious":    2.5,
+	"subtle":      2.65,
+	"tasty":       3.5,
+	"wonderful":   4.5,
+	// negative
+	"awful":         -4.5,
+	"bad":           -2.5,
+	"bland":         -2,
+	"broken":        -3.5,
+	"buggy":         -3,
+	"cheap":         -1.5,
+	"cold":          -1.5,
+	"cramped":       -2.5,
+	"dirty":         -3.5,
+	"disappointing": -3,
+	"expensive":     -2,
+	"hate":          -3.5,
+	"hated":         -3.5,
+	"horrible":      -4.5,
+	"noisy":         -2.5,
+	"overpriced":    -3,
+	"poor":          -3,
+	"rude":          -3.5,
+	"slow":          -2,
+	"smelly":        -3,
+	"terrible":      -4.5,
+	"unfriendly":    -3,
+	"worst":         -4.5,
+}
+
+// negators flip the polarity of the next opinion word within negationWindow
+// words.
+var negators = map[string]bool{
+	"not":     true,
+	"no":      true,
+	"never":   true,
+	"don't":   true,
+	"didn't":  true,
+	"doesn't": true,
+	"isn't":   true,
+	"wasn't":  true,
+	"aren't":  true,
+	"weren't": true,
+}
+
+const negationWindow = 3
+
+// intensifiers scale the weight of the opinion word directly after them.
+var intensifiers = map[string]float64{
+	"very":       1.5,
+	"really":     1.5,
+	"extremely":  2,
+	"incredibly": 2,
+	"so":         1.3,
+	"slightly":   0.5,
+	"somewhat":   0.6,
+}
+
+// otherCategory is used for opinions that aren't about any known aspect, the
+// same way the remote API does.
+const otherCategory = "Other"
+
+// generalAspect is the aspect opinions are attached to when a sentence has no
+// recognizable aspect term.
+const generalAspect = "general"
+
+// category is a group of related aspect terms within an ontology.
+type category struct {
+	name  string
+	terms []string
+}
+
+// ontologies maps each built-in ontology to its aspect categories.
+var ontologies = map[intellexer.Ontology][]category{
+	intellexer.Hotels: {
+		{"Room", []string{"room", "bed", "bathroom", "shower", "view", "suite", "balcony"}},
+		{"Service", []string{"service", "staff", "reception", "receptionist", "concierge", "housekeeping"}},
+		{"Location", []string{"location", "neighborhood", "area", "beach", "downtown"}},
+		{"Food", []string{"breakfast", "restaurant", "food", "buffet", "bar"}},
+		{"Facilities", []string{"pool", "gym", "spa", "parking", "wifi", "elevator", "lobby"}},
+		{"Price", []string{"price", "rate", "value", "cost"}},
+	},
+	intellexer.Restaurants: {
+		{"Food", []string{"food", "meal", "dish", "pizza", "pasta", "steak", "dessert", "salad", "soup", "burger", "flavor"}},
+		{"Drinks", []string{"coffee", "tea", "wine", "beer", "drink", "drinks", "cocktail", "juice"}},
+		{"Service", []string{"service", "waiter", "waitress", "staff", "server", "host"}},
+		{"Ambience", []string{"atmosphere", "ambience", "music", "decor", "place", "table"}},
+		{"Price", []string{"price", "prices", "bill", "value", "portion", "portions"}},
+	},
+	intellexer.Gadgets: {
+		{"Battery", []string{"battery", "charge", "charger", "charging"}},
+		{"Display", []string{"screen", "display", "resolution", "brightness"}},
+		{"Performance", []string{"performance", "speed", "processor", "app", "apps", "software"}},
+		{"Design", []string{"design", "build", "case", "size", "weight", "gadget", "device"}},
+		{"Camera", []string{"camera", "photo", "photos", "video", "lens"}},
+		{"Audio", []string{"sound", "speaker", "speakers", "audio", "headphones"}},
+		{"Price", []string{"price", "value", "cost"}},
+	},
+}
+
+// aspectIndex maps each aspect term to its category name for one ontology.
+type aspectIndex map[string]string
+
+func buildAspectIndex(categories []category) aspectIndex {
+	index := make(aspectIndex)
+	for _, c := range categories {
+		for _, term := range c.terms {
+			index[term] = c.name
+		}
+	}
+	return index
+}
@@ -0,0 +1,73 @@
+package local
+
+import (
+	"strings"
+	"unicode"
+)
+
+// token is a word in a piece of text, with its byte offsets in that text.
+type token struct {
+	word  string // lowercased
+	start int
+	end   int
+}
+
+// sentence is a span of text ending in sentence punctuation (or the end of
+// the text), along with its tokens. Token offsets are relative to text.
+type sentence struct {
+	text   string
+	tokens []token
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\'' || r == '-'
+}
+
+// tokenize splits text into lowercased words, keeping track of where each word
+// is so it can be annotated later.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, newToken(text, start, i))
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, newToken(text, start, len(text)))
+	}
+	return tokens
+}
+
+func newToken(text string, start, end int) token {
+	word := strings.Trim(text[start:end], "'-")
+	return token{word: strings.ToLower(word), start: start, end: end}
+}
+
+// splitSentences splits text on '.', '!' and '?', dropping empty sentences.
+func splitSentences(text string) []sentence {
+	var sentences []sentence
+	start := 0
+	add := func(end int) {
+		raw := text[start:end]
+		trimmed := strings.TrimSpace(raw)
+		if len(trimmed) > 0 {
+			sentences = append(sentences, sentence{text: trimmed, tokens: tokenize(trimmed)})
+		}
+	}
+	for i, r := range text {
+		if r == '.' || r == '!' || r == '?' {
+			add(i + 1)
+			start = i + 1
+		}
+	}
+	add(len(text))
+	return sentences
+}
@@ -0,0 +1,63 @@
+package local
+
+// topicModels maps each topic the local extractor knows about to the keywords
+// that indicate it. Topics use the same dotted taxonomy as the remote API.
+// Keywords are matched against lowercased words, so they must be lowercase, and
+// they must be specific to the topic: common words like "it", "data" or
+// "space" would tag most documents.
+var topicModels = map[string][]string{
+	"Business.finance": {
+		"bank", "banking", "finance", "financial", "investor", "investors",
+		"stock", "stocks", "earnings", "revenue",
+	},
+	"Business.real_estate": {
+		"mortgage", "housing", "realtor", "tenant", "landlord",
+	},
+	"Entertainment.movies": {
+		"movie", "movies", "film", "films", "actor", "actress",
+		"cinema", "hollywood", "box-office",
+	},
+	"Entertainment.music": {
+		"music", "album", "song", "songs", "concert", "singer", "guitar",
+	},
+	"Food.cooking": {
+		"recipe", "recipes", "cooking", "bake", "baking", "ingredients", "chef",
+		"kitchen", "oven",
+	},
+	"Health.healthcare": {
+		"health", "healthcare", "hospital", "hospitals", "doctor",
+		"doctors", "patient", "patients", "nurse", "medical", "clinic", "insurance",
+	},
+	"Health.nutrition": {
+		"nutrition", "diet", "vitamin", "vitamins", "calories", "protein", "obesity",
+	},
+	"Politics.elections": {
+		"election", "elections", "vote", "votes", "voter", "voters", "ballot",
+		"candidate", "poll", "polls",
+	},
+	"Science.climate": {
+		"climate", "emissions", "carbon", "warming", "greenhouse",
+	},
+	"Science.space": {
+		"nasa", "spacecraft", "rocket", "orbit", "planet", "planets", "astronaut",
+		"astronauts", "telescope", "galaxy", "mars",
+	},
+	"Sports.basketball": {
+		"basketball", "nba", "dunk", "playoffs", "rebound",
+	},
+	"Sports.football": {
+		"football", "nfl", "quarterback", "touchdown", "soccer", "league",
+	},
+	"Tech.information_technology": {
+		"tech", "technology", "software", "computer", "computers", "internet",
+		"programming", "cybersecurity",
+	},
+	"Tech.mobile_devices": {
+		"smartphone", "smartphones", "phone", "phones", "iphone", "android",
+		"tablet", "mobile", "app", "apps",
+	},
+	"Travel.tourism": {
+		"travel", "tourism", "tourist", "tourists", "hotel", "flight", "flights",
+		"vacation", "airline",
+	},
+}
@@ -0,0 +1,105 @@
+package local
+
+import (
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/amccarthy1/intellexer"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultMaxTopics = 5
+	// relativeThreshold is the fraction of the best topic's score another topic
+	// needs to be reported. It keeps a single stray keyword from producing a
+	// topic in a long document.
+	relativeThreshold = 0.25
+)
+
+// TopicExtractor is a keyword-based topic classifier. It reports every topic
+// whose keywords appear in the document at least MinHits times and at least a
+// quarter as often as the best topic's keywords.
+type TopicExtractor struct {
+	keywords  map[string][]string
+	maxTopics int
+	minHits   int
+}
+
+var _ intellexer.TopicExtractor = (*TopicExtractor)(nil)
+
+// NewTopicExtractor returns a topic extractor using the built-in keyword
+// models.
+func NewTopicExtractor() *TopicExtractor {
+	keywords := make(map[string][]string)
+	for topic, words := range topicModels {
+		for _, word := range words {
+			keywords[word] = append(keywords[word], topic)
+		}
+	}
+	return &TopicExtractor{
+		keywords:  keywords,
+		maxTopics: defaultMaxTopics,
+		minHits:   1,
+	}
+}
+
+// WithMaxTopics sets the maximum number of topics returned. Default 5.
+func (te *TopicExtractor) WithMaxTopics(n int) *TopicExtractor {
+	te.maxTopics = n
+	return te
+}
+
+// WithMinHits sets the minimum number of keyword occurrences a topic needs to
+// be reported. Default 1.
+func (te *TopicExtractor) WithMinHits(n int) *TopicExtractor {
+	te.minHits = n
+	return te
+}
+
+// GetTopics reads the whole document and returns its topics, most relevant
+// first.
+func (te *TopicExtractor) GetTopics(body io.Reader) ([]string, error) {
+	text, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading document")
+	}
+	return te.extract(string(text)), nil
+}
+
+// GetTopicsFromText is a convenience function to get topics from a string.
+func (te *TopicExtractor) GetTopicsFromText(text string) ([]string, error) {
+	return te.GetTopics(strings.NewReader(text))
+}
+
+func (te *TopicExtractor) extract(text string) []string {
+	hits := make(map[string]int)
+	for _, tok := range tokenize(text) {
+		for _, topic := range te.keywords[tok.word] {
+			hits[topic]++
+		}
+	}
+	best := 0
+	for _, count := range hits {
+		if count > best {
+			best = count
+		}
+	}
+	topics := []string{}
+	for topic, count := range hits {
+		if count >= te.minHits && float64(count) >= relativeThreshold*float64(best) {
+			topics = append(topics, topic)
+		}
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		if hits[topics[i]] != hits[topics[j]] {
+			return hits[topics[i]] > hits[topics[j]]
+		}
+		return topics[i] < topics[j]
+	})
+	if te.maxTopics > 0 && len(topics) > te.maxTopics {
+		topics = topics[:te.maxTopics]
+	}
+	return topics
+}
@@ -0,0 +1,61 @@
+package local
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTopics(t *testing.T) {
+	extractor := NewTopicExtractor()
+	topics, err := extractor.GetTopicsFromText("I'm an article about tech health care")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Health.healthcare", "Tech.information_technology"}, topics)
+
+	topics, err = extractor.GetTopics(strings.NewReader(""))
+	assert.Nil(t, err)
+	assert.Empty(t, topics)
+	assert.NotNil(t, topics)
+}
+
+func TestGetTopicsRanking(t *testing.T) {
+	article := "The NASA rocket reached orbit. Astronauts on the space station " +
+		"watched Mars through a telescope. The launch was streamed on the internet."
+	extractor := NewTopicExtractor()
+	topics, err := extractor.GetTopicsFromText(article)
+	assert.Nil(t, err)
+	// "internet" is a single stray keyword compared to six space keywords
+	assert.Equal(t, []string{"Science.space"}, topics)
+
+	topics, err = extractor.WithMinHits(2).GetTopicsFromText("voters went to the polls to vote in the election")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Politics.elections"}, topics)
+
+	topics, err = NewTopicExtractor().WithMaxTopics(1).GetTopicsFromText("hospital software")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Health.healthcare"}, topics)
+}
+
+func TestGetTopicsOrdinaryProse(t *testing.T) {
+	prose := "It was a quiet afternoon and it rained. We took care of the garden, " +
+		"then walked past the market to the court behind the park. The data on " +
+		"the sign said the open space would close soon, so our goal was to be " +
+		"home before dark, and it was."
+	topics, err := NewTopicExtractor().GetTopicsFromText(prose)
+	assert.Nil(t, err)
+	assert.Empty(t, topics)
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func TestGetTopicsReadError(t *testing.T) {
+	topics, err := NewTopicExtractor().GetTopics(errReader{})
+	assert.Nil(t, topics)
+	assert.Contains(t, err.Error(), "Error reading document")
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/amccarthy1/intellexer"
+)
+
+var commands = map[string]*command{
+	"analyze_sentiments": {
+		name:    "analyze_sentiments",
+		args:    "review [review...]",
+		summary: "Analyze the sentiment of one or more reviews",
+		setup:   setupAnalyzeSentiments,
+	},
+	"crawl_topics": {
+		name:    "crawl_topics",
+		args:    "directory",
+		summary: "Extract the topics of every file under a directory",
+		setup:   setupCrawlTopics,
+	},
+	"get_topics": {
+		name:    "get_topics",
+		args:    "path/to/article",
+		summary: "Extract the topics of an article on disk",
+		setup:   setupGetTopics,
+	},
+	"get_topics_from_url": {
+		name:    "get_topics_from_url",
+		args:    "url",
+		summary: "Extract the topics of the article at a URL",
+		setup:   setupGetTopicsFromURL,
+	},
+	"opinion_tree": {
+		name:    "opinion_tree",
+		args:    "review [review...]",
+		summary: "Show the opinion tree of one or more reviews",
+		setup:   setupOpinionTree,
+	},
+	"repl": {
+		name:    "repl",
+		summary: "Explore the API interactively",
+		setup:   setupREPL,
+	},
+	"rpc": {
+		name:    "rpc",
+		summary: "Serve the API over JSON-RPC 2.0 on stdio or TCP",
+		setup:   setupRPC,
+	},
+	"server": {
+		name:    "server",
+		summary: "Serve the API as an internal JSON HTTP service",
+		setup:   setupServer,
+	},
+	"list_ontologies": {
+		name:    "list_ontologies",
+		summary: "List the ontologies available for sentiment analysis",
+		setup:   setupListOntologies,
+	},
+}
+
+func setupAnalyzeSentiments(fs *flag.FlagSet) runFunc {
+	ontology := fs.String("ontology", string(intellexer.Gadgets), "ontology to analyze the reviews in (hotels, restaurants, gadgets)")
+	input := fs.String("input", "", "read reviews from this file instead of the arguments (- for stdin)")
+	inputFormat := fs.String("input-format", "lines", "format of the input file ("+strings.Join(inputFormats, ", ")+")")
+	idColumn := fs.String("id-column", "id", "CSV column holding review IDs (empty to use row numbers)")
+	textColumn := fs.String("text-column", "text", "CSV column holding review text")
+	batchSize := fs.Int("batch-size", 100, "maximum number of reviews per request")
+	batchBytes := fs.Int("batch-bytes", 64*1024, "maximum total review text per request, in bytes")
+	return func(env *environment, args []string) error {
+		var reader reviewReader
+		switch {
+		case len(*input) > 0 && len(args) > 0:
+			return usageError{"reviews can't be given as arguments when using --input"}
+		case len(*input) > 0:
+			in := env.stdin
+			if *input != "-" {
+				file, err := os.Open(*input)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				in = file
+			}
+			var err error
+			if reader, err = newReviewReader(in, *inputFormat, *idColumn, *textColumn); err != nil {
+				return err
+			}
+		case len(args) > 0:
+			reader = &argsReader{args: args}
+		default:
+			return usageError{"at least one review is required"}
+		}
+
+		batches := &batcher{reader: reader, maxCount: *batchSize, maxBytes: *batchBytes}
+		out := newStreamWriter(env.stdout, env.format).withCombine(combineSentiments)
+		for {
+			batch, err := batches.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			res, err := env.client.AnalyzeSentiments(intellexer.Ontology(*ontology), batch)
+			if err != nil {
+				return err
+			}
+			if err := out.write(sentimentResults(batch, res)); err != nil {
+				return err
+			}
+		}
+		return out.close()
+	}
+}
+
+func setupGetTopics(fs *flag.FlagSet) runFunc {
+	return func(env *environment, args []string) error {
+		if len(args) != 1 {
+			return usageError{"exactly one file is required"}
+		}
+		file, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		upload, err := intellexer.NewFileUpload(file)
+		if err != nil {
+			return err
+		}
+		topics, err := env.client.GetTopicsFromUpload(env.ctx, upload)
+		if err != nil {
+			return err
+		}
+		return topicResults(topics).write(env.stdout, env.format)
+	}
+}
+
+func setupGetTopicsFromURL(fs *flag.FlagSet) runFunc {
+	return func(env *environment, args []string) error {
+		if len(args) != 1 {
+			return usageError{"exactly one URL is required"}
+		}
+		topics, err := env.client.GetTopicsFromURL(args[0])
+		if err != nil {
+			return err
+		}
+		return topicResults(topics).write(env.stdout, env.format)
+	}
+}
+
+func setupListOntologies(fs *flag.FlagSet) runFunc {
+	return func(env *environment, args []string) error {
+		if len(args) != 0 {
+			return usageError{"list_ontologies takes no arguments"}
+		}
+		ontologies, err := env.client.ListOntologies()
+		if err != nil {
+			return err
+		}
+		return ontologyResults(ontologies).write(env.stdout, env.format)
+	}
+}
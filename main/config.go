@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/amccarthy1/intellexer"
+)
+
+// Settings are resolved in this order, the first one set winning:
+//
+//  1. command-line flags
+//  2. environment variables (API_KEY and the INTELLEXER_* variables below)
+//  3. the selected profile of the config file
+//  4. the defaults of the flags
+//
+// The config file is read from --config, INTELLEXER_CONFIG, or
+// intellexer/config.json in the user config directory, in that order. The
+// profile is chosen with --profile, INTELLEXER_PROFILE, or the default_profile
+// of the config file, and falls back to the profile named "default".
+const (
+	configEnv  = "INTELLEXER_CONFIG"
+	profileEnv = "INTELLEXER_PROFILE"
+	apiKeyEnv  = "API_KEY"
+)
+
+const defaultProfile = "default"
+
+// profile is a named set of settings in the config file.
+type profile struct {
+	// APIKey is the key itself. Prefer APIKeyEnv or APIKeyFile, which keep it out
+	// of the config file.
+	APIKey string `json:"api_key,omitempty"`
+	// APIKeyEnv is the name of an environment variable holding the key.
+	APIKeyEnv string `json:"api_key_env,omitempty"`
+	// APIKeyFile is the path of a file holding the key, re-read when it changes.
+	APIKeyFile string `json:"api_key_file,omitempty"`
+	BaseURL    string `json:"base_url,omitempty"`
+	Ontology   string `json:"ontology,omitempty"`
+	// Timeout is a duration such as "10s".
+	Timeout string `json:"timeout,omitempty"`
+	Format  string `json:"format,omitempty"`
+}
+
+// config is the contents of the config file.
+type config struct {
+	DefaultProfile string             `json:"default_profile,omitempty"`
+	Profiles       map[string]profile `json:"profiles"`
+}
+
+// profileSettings maps flags to the environment variable and profile field
+// that can provide their value.
+var profileSettings = []struct {
+	flag  string
+	env   string
+	value func(p profile) string
+}{
+	{"base-url", "INTELLEXER_BASE_URL", func(p profile) string { return p.BaseURL }},
+	{"timeout", "INTELLEXER_TIMEOUT", func(p profile) string { return p.Timeout }},
+	{"format", "INTELLEXER_FORMAT", func(p profile) string { return p.Format }},
+	{"ontology", "INTELLEXER_ONTOLOGY", func(p profile) string { return p.Ontology }},
+}
+
+// userConfigDir returns the user config directory, or "" if it can't be
+// determined. It follows os.UserConfigDir, which needs Go 1.13.
+func userConfigDir(getenv func(string) (string, bool)) string {
+	lookup := func(key string) string {
+		value, _ := getenv(key)
+		return value
+	}
+	var dir string
+	switch runtime.GOOS {
+	case "windows":
+		return lookup("AppData")
+	case "darwin":
+		dir = lookup("HOME")
+		if len(dir) > 0 {
+			dir = filepath.Join(dir, "Library", "Application Support")
+		}
+		return dir
+	case "plan9":
+		dir = lookup("home")
+		if len(dir) > 0 {
+			dir = filepath.Join(dir, "lib")
+		}
+		return dir
+	}
+	if dir = lookup("XDG_CONFIG_HOME"); len(dir) > 0 {
+		return dir
+	}
+	if dir = lookup("HOME"); len(dir) > 0 {
+		dir = filepath.Join(dir, ".config")
+	}
+	return dir
+}
+
+// loadConfig reads the config file. A missing file is only an error if its path
+// was given explicitly.
+func loadConfig(path string, getenv func(string) (string, bool)) (*config, error) {
+	explicit := true
+	if len(path) == 0 {
+		path, _ = getenv(configEnv)
+	}
+	if len(path) == 0 {
+		explicit = false
+		dir := userConfigDir(getenv)
+		if len(dir) == 0 {
+			return &config{}, nil
+		}
+		path = filepath.Join(dir, "intellexer", "config.json")
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) && !explicit {
+		return &config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var cfg config
+	if err := json.NewDecoder(file).Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	return &cfg, nil
+}
+
+// profile returns the named profile. An empty name selects the default
+// profile, which doesn't have to exist.
+func (cfg *config) profile(name string, getenv func(string) (string, bool)) (profile, error) {
+	if len(name) == 0 {
+		name, _ = getenv(profileEnv)
+	}
+	if len(name) == 0 {
+		name = cfg.DefaultProfile
+	}
+	if len(name) == 0 {
+		return cfg.Profiles[defaultProfile], nil
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		return profile{}, fmt.Errorf("unknown profile %q", name)
+	}
+	return p, nil
+}
+
+// applyProfile sets the flags that weren't given on the command line from the
+// environment or the profile.
+func applyProfile(fs *flag.FlagSet, p profile, getenv func(string) (string, bool)) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	for _, setting := range profileSettings {
+		if given[setting.flag] || fs.Lookup(setting.flag) == nil {
+			continue
+		}
+		source, value := setting.env, ""
+		if env, ok := getenv(setting.env); ok && len(env) > 0 {
+			value = env
+		} else {
+			source, value = "profile", setting.value(p)
+		}
+		if len(value) == 0 {
+			continue
+		}
+		if err := fs.Set(setting.flag, value); err != nil {
+			return fmt.Errorf("invalid %s from %s: %v", setting.flag, source, err)
+		}
+	}
+	return nil
+}
+
+// credentials returns the API key source: API_KEY if set, otherwise the key
+// source of the profile.
+func credentials(p profile, getenv func(string) (string, bool)) (intellexer.CredentialProvider, error) {
+	if key, ok := getenv(apiKeyEnv); ok && len(key) > 0 {
+		return intellexer.StaticKey(key), nil
+	}
+	switch {
+	case len(p.APIKey) > 0:
+		return intellexer.StaticKey(p.APIKey), nil
+	case len(p.APIKeyEnv) > 0:
+		key, ok := getenv(p.APIKeyEnv)
+		if !ok || len(key) == 0 {
+			return nil, fmt.Errorf("environment variable %s of the profile is not set", p.APIKeyEnv)
+		}
+		return intellexer.StaticKey(key), nil
+	case len(p.APIKeyFile) > 0:
+		provider := intellexer.NewFileCredentials(p.APIKeyFile)
+		if _, err := provider.APIKey(); err != nil {
+			return nil, err
+		}
+		return provider, nil
+	}
+	return nil, fmt.Errorf("no API key given, please run with %s=<api key> or set one in a profile", apiKeyEnv)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/amccarthy1/intellexer/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, dir, contents string) string {
+	path := filepath.Join(dir, "config.json")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(contents), 0600))
+	return path
+}
+
+func TestProfiles(t *testing.T) {
+	server := mocks.NewFakeServer("secret")
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "intellexer")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "key")
+	assert.Nil(t, ioutil.WriteFile(keyFile, []byte("secret\n"), 0600))
+
+	path := writeConfig(t, dir, `{
+		"default_profile": "fake",
+		"profiles": {
+			"fake": {"api_key_file": "`+keyFile+`", "base_url": "`+server.URL+`", "format": "csv", "ontology": "hotels"},
+			"env": {"api_key_env": "FAKE_KEY", "base_url": "`+server.URL+`", "timeout": "5s"},
+			"broken": {"api_key": "secret", "timeout": "soon"}
+		}
+	}`)
+	env := map[string]string{configEnv: path}
+
+	// The default profile sets the key, base URL, format and ontology
+	code, stdout, stderr := runCLIWithEnv(t, env, "", "great\n", "analyze_sentiments", "--input", "-")
+	assert.Equal(t, exitOK, code, stderr)
+	assert.Equal(t, "id,weight,text\n1,2,great\n", stdout)
+	code, stdout, _ = runCLIWithEnv(t, env, "", "", "analyze_sentiments", "--format", "json", "great")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, `"ontology": "hotels"`)
+
+	// Flags beat environment variables, which beat the profile
+	env["INTELLEXER_FORMAT"] = "ndjson"
+	code, stdout, _ = runCLIWithEnv(t, env, "", "", "list_ontologies")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, `{"ontology":"Hotels"}`)
+	code, stdout, _ = runCLIWithEnv(t, env, "", "", "list_ontologies", "--format", "text")
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "Hotels\nRestaurants\nGadgets\n", stdout)
+	delete(env, "INTELLEXER_FORMAT")
+
+	env["API_KEY"] = "wrong"
+	code, _, stderr = runCLIWithEnv(t, env, "", "", "list_ontologies")
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, "Request Error")
+	delete(env, "API_KEY")
+
+	code, _, stderr = runCLIWithEnv(t, env, "", "", "list_ontologies", "--profile", "env")
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, "FAKE_KEY of the profile is not set")
+	env["FAKE_KEY"] = "secret"
+	env[profileEnv] = "env"
+	code, stdout, _ = runCLIWithEnv(t, env, "", "", "list_ontologies")
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "Hotels\nRestaurants\nGadgets\n", stdout)
+
+	code, _, stderr = runCLIWithEnv(t, env, "", "", "list_ontologies", "--profile", "broken")
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, "invalid timeout from profile")
+
+	code, _, stderr = runCLIWithEnv(t, env, "", "", "list_ontologies", "--profile", "missing")
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, `unknown profile "missing"`)
+
+	code, _, stderr = runCLIWithEnv(t, nil, "", "", "list_ontologies", "--config", filepath.Join(dir, "missing.json"))
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, "no such file")
+}
+
+func TestDefaultConfigPath(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" || runtime.GOOS == "plan9" {
+		t.Skip("XDG_CONFIG_HOME is only used on Unix")
+	}
+	dir, err := ioutil.TempDir("", "intellexer")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "intellexer"), 0755))
+	writeConfig(t, filepath.Join(dir, "intellexer"), `{"profiles": {"default": {"api_key": "from-config"}}}`)
+
+	cfg, err := loadConfig("", func(key string) (string, bool) {
+		if key == "XDG_CONFIG_HOME" {
+			return dir, true
+		}
+		return "", false
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "from-config", cfg.Profiles["default"].APIKey)
+
+	assert.Equal(t, "/home/me/.config", userConfigDir(func(key string) (string, bool) {
+		if key == "HOME" {
+			return "/home/me", true
+		}
+		return "", false
+	}))
+	assert.Equal(t, "", userConfigDir(func(string) (string, bool) { return "", false }))
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/amccarthy1/intellexer"
+)
+
+func setupCrawlTopics(fs *flag.FlagSet) runFunc {
+	include := fs.String("include", "", "comma-separated globs of the files to include, matched against the name and the relative path (default all)")
+	exclude := fs.String("exclude", "", "comma-separated globs of the files to skip")
+	maxSize := fs.Int64("max-size", 1<<20, "skip files larger than this many bytes")
+	concurrency := fs.Int("concurrency", 4, "number of files to process at once")
+	checkpoint := fs.String("checkpoint", "", "record finished files in this file, and skip the files it lists when resuming")
+	summary := fs.String("summary", "", "write the corpus topic summary to this file instead of after the report")
+	return func(env *environment, args []string) error {
+		if len(args) != 1 {
+			return usageError{"exactly one directory is required"}
+		}
+		if *concurrency < 1 {
+			return usageError{"--concurrency must be at least 1"}
+		}
+		if len(*summary) == 0 && (env.format == "csv" || env.format == "ndjson") {
+			return usageError{"--summary is required with --format " + env.format}
+		}
+		c := &crawler{
+			env:      env,
+			root:     args[0],
+			includes: splitGlobs(*include),
+			excludes: splitGlobs(*exclude),
+			maxSize:  *maxSize,
+		}
+		for _, glob := range append(c.includes, c.excludes...) {
+			if _, err := filepath.Match(glob, ""); err != nil {
+				return usageError{fmt.Sprintf("invalid glob %q", glob)}
+			}
+		}
+		return c.run(*concurrency, *checkpoint, *summary)
+	}
+}
+
+func splitGlobs(list string) []string {
+	var globs []string
+	for _, glob := range strings.Split(list, ",") {
+		if glob = strings.TrimSpace(glob); len(glob) > 0 {
+			globs = append(globs, glob)
+		}
+	}
+	return globs
+}
+
+// fileResult is the outcome of extracting the topics of one file. It is both a
+// row of the report and a line of the checkpoint file.
+type fileResult struct {
+	Path   string   `json:"path"`
+	Topics []string `json:"topics"`
+	Error  string   `json:"error,omitempty"`
+}
+
+func (fr fileResult) results() results {
+	return results{
+		full:    fr,
+		columns: []string{"path", "topics", "error"},
+		rows:    [][]string{{fr.Path, strings.Join(fr.Topics, " "), fr.Error}},
+		records: []interface{}{fr},
+		text: func(w io.Writer) {
+			if len(fr.Error) > 0 {
+				fmt.Fprintf(w, "%s: error: %s\n", fr.Path, fr.Error)
+				return
+			}
+			fmt.Fprintf(w, "%s: %s\n", fr.Path, strings.Join(fr.Topics, ", "))
+		},
+	}
+}
+
+// crawler extracts the topics of every matching file under a directory.
+type crawler struct {
+	env      *environment
+	root     string
+	includes []string
+	excludes []string
+	maxSize  int64
+}
+
+func matchesAny(globs []string, rel string) bool {
+	for _, glob := range globs {
+		if ok, _ := filepath.Match(glob, filepath.Base(rel)); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(glob, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// files lists the files to process, relative to the root, in lexical order.
+// Paths below the root that can't be read are returned as failed results
+// instead of stopping the walk.
+func (c *crawler) files() ([]string, []fileResult, error) {
+	var files []string
+	var unreadable []fileResult
+	err := filepath.Walk(c.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == c.root {
+				return err
+			}
+			rel, _ := filepath.Rel(c.root, path)
+			unreadable = append(unreadable, fileResult{Path: filepath.ToSlash(rel), Error: err.Error()})
+			// Returning nil skips the contents of a directory that can't be read
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(c.root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if len(c.includes) > 0 && !matchesAny(c.includes, rel) || matchesAny(c.excludes, rel) {
+			return nil
+		}
+		if info.Size() > c.maxSize {
+			fmt.Fprintf(c.env.stderr, "skipping %s: %d bytes is over --max-size\n", rel, info.Size())
+			return nil
+		}
+		files = append(files, rel)
+		return nil
+	})
+	return files, unreadable, err
+}
+
+// readCheckpoint returns the files recorded in a checkpoint file, which
+// doesn't have to exist yet.
+func readCheckpoint(path string) ([]fileResult, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var done []fileResult
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var result fileResult
+		// A line cut short by an interruption is ignored, so that file is
+		// processed again.
+		if err := json.Unmarshal(scanner.Bytes(), &result); err == nil {
+			done = append(done, result)
+		}
+	}
+	return done, scanner.Err()
+}
+
+func (c *crawler) extract(rel string) fileResult {
+	result := fileResult{Path: rel}
+	file, err := os.Open(filepath.Join(c.root, filepath.FromSlash(rel)))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer file.Close()
+	upload, err := intellexer.NewFileUpload(file)
+	if err == nil {
+		result.Topics, err = c.env.client.GetTopicsFromUpload(c.env.ctx, upload)
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (c *crawler) run(concurrency int, checkpointPath, summaryPath string) error {
+	files, unreadable, err := c.files()
+	if err != nil {
+		return err
+	}
+	var done []fileResult
+	var checkpoint io.Writer
+	if len(checkpointPath) > 0 {
+		if done, err = readCheckpoint(checkpointPath); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(checkpointPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		checkpoint = file
+	}
+
+	report := newStreamWriter(c.env.stdout, c.env.format)
+	freq := newTopicFrequency()
+	finished := make(map[string]bool, len(done))
+	for _, result := range done {
+		finished[result.Path] = true
+		freq.add(result.Topics)
+		if err := report.write(result.results()); err != nil {
+			return err
+		}
+	}
+
+	// Only the files sent now count towards the failures, not the ones done
+	// before resuming
+	attempted := len(unreadable)
+	for _, rel := range files {
+		if !finished[rel] {
+			attempted++
+		}
+	}
+	for _, result := range unreadable {
+		if err := report.write(result.results()); err != nil {
+			return err
+		}
+	}
+
+	todo := make(chan string)
+	results := make(chan fileResult)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rel := range todo {
+				results <- c.extract(rel)
+			}
+		}()
+	}
+	go func() {
+		for _, rel := range files {
+			if !finished[rel] {
+				todo <- rel
+			}
+		}
+		close(todo)
+		wg.Wait()
+		close(results)
+	}()
+
+	// Results are written from this goroutine only, so the report and
+	// checkpoint need no locking. Keep draining on errors so the workers
+	// can finish.
+	failed := len(unreadable)
+	var writeErr error
+	for result := range results {
+		if len(result.Error) > 0 {
+			failed++
+		} else {
+			freq.add(result.Topics)
+			if checkpoint != nil && writeErr == nil {
+				line, _ := json.Marshal(result)
+				_, writeErr = checkpoint.Write(append(line, '\n'))
+			}
+		}
+		if writeErr == nil {
+			writeErr = report.write(result.results())
+		}
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	if err := c.writeSummary(report, freq, summaryPath); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed", failed, attempted)
+	}
+	return nil
+}
+
+// crawlReport is the json output of a crawl without a --summary file.
+type crawlReport struct {
+	Files  interface{} `json:"files"`
+	Topics interface{} `json:"topics"`
+}
+
+// writeSummary finishes the report and writes the topic summary, to
+// summaryPath if given. Otherwise the text and table formats write the summary
+// after the report, and json writes both as one document; the other formats
+// have no room for a second schema, so they require a summary file.
+func (c *crawler) writeSummary(report *streamWriter, freq *topicFrequency, summaryPath string) error {
+	if len(summaryPath) == 0 && c.env.format == "json" {
+		files := report.full
+		if files == nil {
+			files = []interface{}{}
+		}
+		return results{full: crawlReport{Files: files, Topics: freq.results().full}}.write(c.env.stdout, "json")
+	}
+	if err := report.close(); err != nil {
+		return err
+	}
+	out := c.env.stdout
+	if len(summaryPath) > 0 {
+		file, err := os.Create(summaryPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	} else {
+		fmt.Fprintln(out)
+	}
+	return freq.results().write(out, c.env.format)
+}
+
+// topicFrequency counts the files each topic was found in.
+type topicFrequency struct {
+	files  int
+	counts map[string]int
+}
+
+func newTopicFrequency() *topicFrequency {
+	return &topicFrequency{counts: make(map[string]int)}
+}
+
+func (tf *topicFrequency) add(topics []string) {
+	tf.files++
+	for _, topic := range topics {
+		tf.counts[topic]++
+	}
+}
+
+type topicCount struct {
+	Topic string  `json:"topic"`
+	Files int     `json:"files"`
+	Share float64 `json:"share"`
+}
+
+// results lists the topics from most to least frequent, with the share of
+// files they were found in.
+func (tf *topicFrequency) results() results {
+	counts := []topicCount{}
+	for topic, n := range tf.counts {
+		counts = append(counts, topicCount{Topic: topic, Files: n, Share: float64(n) / float64(tf.files)})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Files != counts[j].Files {
+			return counts[i].Files > counts[j].Files
+		}
+		return counts[i].Topic < counts[j].Topic
+	})
+	r := results{
+		full:    counts,
+		columns: []string{"topic", "files", "share"},
+		text: func(w io.Writer) {
+			fmt.Fprintf(w, "Topics across %d files:\n", tf.files)
+			for _, count := range counts {
+				fmt.Fprintf(w, "%5d  %5.1f%%  %s\n", count.Files, 100*count.Share, count.Topic)
+			}
+		},
+	}
+	for _, count := range counts {
+		r.rows = append(r.rows, []string{count.Topic, strconv.Itoa(count.Files), formatWeight(count.Share)})
+		r.records = append(r.records, count)
+	}
+	return r
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amccarthy1/intellexer/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrawlTopics(t *testing.T) {
+	server := mocks.NewFakeServer("secret")
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "intellexer")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	corpus := filepath.Join(dir, "corpus")
+	files := map[string]string{
+		"a.txt":         "health news",
+		"sub/b.txt":     "football and tech",
+		"sub/c.log":     "health",
+		"big.txt":       strings.Repeat("tech ", 100),
+		"sub/deep/d.md": "football",
+	}
+	for name, contents := range files {
+		path := filepath.Join(corpus, filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	}
+	checkpoint := filepath.Join(dir, "checkpoint.jsonl")
+	args := []string{"crawl_topics", "--include", "*.txt,sub/deep/*", "--exclude", "a.*", "--max-size", "100",
+		"--concurrency", "2", "--checkpoint", checkpoint}
+
+	csvSummary := filepath.Join(dir, "summary.csv")
+	code, stdout, stderr := runCLIWithEnv(t, map[string]string{"API_KEY": "secret"}, server.URL, "",
+		append(args, "--format", "csv", "--summary", csvSummary, corpus)...)
+	assert.Equal(t, exitOK, code, stderr)
+	assert.Contains(t, stderr, "skipping big.txt")
+	lines := strings.Split(stdout, "\n")
+	assert.Equal(t, "path,topics,error", lines[0])
+	assert.ElementsMatch(t, []string{
+		"sub/b.txt,Sports.football Tech.information_technology,",
+		"sub/deep/d.md,Sports.football,",
+	}, lines[1:3])
+	assert.Equal(t, "", lines[3])
+	contents, err := ioutil.ReadFile(csvSummary)
+	assert.Nil(t, err)
+	assert.Equal(t, "topic,files,share\nSports.football,2,1\nTech.information_technology,1,0.5\n", string(contents))
+
+	// Without a summary file, csv has nowhere to put the summary
+	code, _, stderr = runCLIWithEnv(t, map[string]string{"API_KEY": "secret"}, server.URL, "",
+		append(args, "--format", "csv", corpus)...)
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "--summary is required")
+
+	// json writes the report and summary as one document
+	code, stdout, stderr = runCLIWithEnv(t, map[string]string{"API_KEY": "secret"}, server.URL, "",
+		append(args, "--format", "json", corpus)...)
+	assert.Equal(t, exitOK, code, stderr)
+	var report struct {
+		Files  []fileResult `json:"files"`
+		Topics []topicCount `json:"topics"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(stdout), &report), stdout)
+	assert.Len(t, report.Files, 2)
+	assert.Equal(t, []topicCount{{"Sports.football", 2, 1}, {"Tech.information_technology", 1, 0.5}}, report.Topics)
+
+	// Resuming only sends the new file, so a bad key only fails that one
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(corpus, "e.txt"), []byte("health"), 0644))
+	summary := filepath.Join(dir, "summary.json")
+	code, stdout, stderr = runCLIWithEnv(t, map[string]string{"API_KEY": "wrong"}, server.URL, "",
+		append(args, "--format", "ndjson", "--summary", summary, corpus)...)
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, "1 of 1 files failed")
+	assert.Contains(t, stdout, `{"path":"sub/deep/d.md","topics":["Sports.football"]}`)
+	assert.Contains(t, stdout, `{"path":"e.txt","topics":null,"error":"Request Error`)
+	contents, err = ioutil.ReadFile(summary)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"topic":"Sports.football","files":2,"share":1}`+"\n"+
+		`{"topic":"Tech.information_technology","files":1,"share":0.5}`+"\n", string(contents))
+}
+
+func TestCrawlUnreadable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read every directory")
+	}
+	server := mocks.NewFakeServer("secret")
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "intellexer")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "locked"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "locked", "a.txt"), []byte("tech"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "b.txt"), []byte("football"), 0644))
+	assert.Nil(t, os.Chmod(filepath.Join(dir, "locked"), 0))
+	defer os.Chmod(filepath.Join(dir, "locked"), 0755)
+
+	// The unreadable directory fails, but the rest is still crawled
+	code, stdout, stderr := runCLIWithEnv(t, map[string]string{"API_KEY": "secret"}, server.URL, "",
+		"crawl_topics", "--format", "ndjson", "--summary", filepath.Join(dir, "summary.json"), dir)
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, "1 of 2 files failed")
+	assert.Contains(t, stdout, `{"path":"b.txt","topics":["Sports.football"]}`)
+	assert.Contains(t, stdout, `"path":"locked"`)
+}
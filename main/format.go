@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/amccarthy1/intellexer"
+)
+
+// formats are the supported output formats:
+//   - text: the plain output the CLI has always printed
+//   - json: pretty printed JSON of the full API response
+//   - ndjson: one JSON object per line, per review/topic/ontology
+//   - csv: comma separated values with a header row
+//   - table: an aligned table for humans
+var formats = []string{"text", "json", "ndjson", "csv", "table"}
+
+func isValidFormat(format string) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// results is a format-independent view of a command's output.
+type results struct {
+	// full is written by the json format.
+	full interface{}
+	// columns and rows are written by the csv and table formats.
+	columns []string
+	rows    [][]string
+	// records are written one per line by the ndjson format, and correspond
+	// to rows.
+	records []interface{}
+	// text writes the text format.
+	text func(w io.Writer)
+}
+
+// write writes the results in the given format, which has already been
+// validated.
+func (r results) write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		encoder := newEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r.full)
+	case "ndjson":
+		encoder := newEncoder(w)
+		for _, record := range r.records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write(r.columns)
+		writer.WriteAll(r.rows)
+		return writer.Error()
+	case "table":
+		writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, strings.ToUpper(strings.Join(r.columns, "\t")))
+		for _, row := range r.rows {
+			fmt.Fprintln(writer, strings.Join(row, "\t"))
+		}
+		return writer.Flush()
+	}
+	r.text(w)
+	return nil
+}
+
+// newEncoder returns a JSON encoder that leaves the <pos> and <neg> tags in
+// annotated sentences readable.
+func newEncoder(w io.Writer) *json.Encoder {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder
+}
+
+// streamWriter writes results as they become available, for commands that
+// make several requests. The csv header is only written once. The table format
+// is buffered until close so the columns line up, and so is the json format so
+// that it writes a single document.
+type streamWriter struct {
+	w           io.Writer
+	format      string
+	wroteHeader bool
+	table       results
+	// full is what the json format writes on close, built by combine.
+	full    interface{}
+	combine func(acc, next interface{}) interface{}
+}
+
+func newStreamWriter(w io.Writer, format string) *streamWriter {
+	return &streamWriter{w: w, format: format, combine: appendFull}
+}
+
+// withCombine sets how the json format combines the full results of every
+// write into one document. By default they are collected into an array.
+func (sw *streamWriter) withCombine(combine func(acc, next interface{}) interface{}) *streamWriter {
+	sw.combine = combine
+	return sw
+}
+
+func appendFull(acc, next interface{}) interface{} {
+	all, _ := acc.([]interface{})
+	return append(all, next)
+}
+
+func (sw *streamWriter) write(r results) error {
+	switch sw.format {
+	case "json":
+		sw.full = sw.combine(sw.full, r.full)
+		return nil
+	case "table":
+		sw.table.columns = r.columns
+		sw.table.rows = append(sw.table.rows, r.rows...)
+		return nil
+	case "csv":
+		writer := csv.NewWriter(sw.w)
+		if !sw.wroteHeader {
+			writer.Write(r.columns)
+			sw.wroteHeader = true
+		}
+		writer.WriteAll(r.rows)
+		return writer.Error()
+	}
+	return r.write(sw.w, sw.format)
+}
+
+// close flushes any buffered output.
+func (sw *streamWriter) close() error {
+	switch {
+	case sw.format == "json" && sw.full != nil:
+		return results{full: sw.full}.write(sw.w, sw.format)
+	case sw.format == "table" && sw.table.columns != nil:
+		return sw.table.write(sw.w, sw.format)
+	}
+	return nil
+}
+
+// combineSentiments merges the sentiment responses of several batches into
+// one with mergeSentiments.
+func combineSentiments(acc, next interface{}) interface{} {
+	combined, _ := acc.(*intellexer.SentimentResponse)
+	return mergeSentiments(combined, next.(*intellexer.SentimentResponse))
+}
+
+// mergeSentiments adds the response to a batch of reviews to combined, and
+// returns combined, or res if combined is nil. Opinions with the same text are
+// merged into one node, with their weights averaged by frequency, and the
+// sentence numbers of res are offset past the sentences already in combined.
+func mergeSentiments(combined, res *intellexer.SentimentResponse) *intellexer.SentimentResponse {
+	if combined == nil {
+		return res
+	}
+	offset := len(combined.Sentences)
+	combined.SentimentsCount += res.SentimentsCount
+	combined.Sentiments = append(combined.Sentiments, res.Sentiments...)
+	combined.Sentences = append(combined.Sentences, res.Sentences...)
+	combined.Opinions = mergeOpinions(combined.Opinions, res.Opinions, offset)
+	return combined
+}
+
+// mergeOpinions merges b into a, adding offset to the sentence numbers of b.
+func mergeOpinions(a, b intellexer.Opinion, offset int) intellexer.Opinion {
+	merged := a
+	merged.F = a.F + b.F
+	if merged.F > 0 {
+		merged.SentimentWeight = (a.SentimentWeight*float64(a.F) + b.SentimentWeight*float64(b.F)) / float64(merged.F)
+	} else {
+		merged.SentimentWeight = (a.SentimentWeight + b.SentimentWeight) / 2
+	}
+	merged.RS = append(append([]int{}, a.RS...), offsetOpinion(b, offset).RS...)
+	merged.Children = append([]intellexer.Opinion{}, a.Children...)
+	for _, child := range b.Children {
+		i := findOpinion(merged.Children, child.Text)
+		if i < 0 {
+			merged.Children = append(merged.Children, offsetOpinion(child, offset))
+			continue
+		}
+		merged.Children[i] = mergeOpinions(merged.Children[i], child, offset)
+	}
+	return merged
+}
+
+// offsetOpinion returns a copy of o with offset added to its sentence numbers
+// and those of its children.
+func offsetOpinion(o intellexer.Opinion, offset int) intellexer.Opinion {
+	shifted := o
+	shifted.RS = make([]int, len(o.RS))
+	for i, sentence := range o.RS {
+		shifted.RS[i] = sentence + offset
+	}
+	shifted.Children = make([]intellexer.Opinion, len(o.Children))
+	for i, child := range o.Children {
+		shifted.Children[i] = offsetOpinion(child, offset)
+	}
+	return shifted
+}
+
+// findOpinion returns the index of the opinion with the given text, or -1.
+func findOpinion(opinions []intellexer.Opinion, text *string) int {
+	for i, o := range opinions {
+		if o.Text == nil && text == nil || o.Text != nil && text != nil && *o.Text == *text {
+			return i
+		}
+	}
+	return -1
+}
+
+// reviewResult is the per-review record of a sentiment analysis.
+type reviewResult struct {
+	ID        string                `json:"id"`
+	Text      string                `json:"text"`
+	Weight    float64               `json:"weight"`
+	Sentences []intellexer.Sentence `json:"sentences,omitempty"`
+}
+
+func formatWeight(weight float64) string {
+	return strconv.FormatFloat(weight, 'f', -1, 64)
+}
+
+// sentimentResults combines a response with the reviews that produced it, so
+// the output can include the text of each review.
+func sentimentResults(reviews []intellexer.Review, res *intellexer.SentimentResponse) results {
+	texts := make(map[string]string, len(reviews))
+	for _, review := range reviews {
+		texts[review.ID] = review.Text
+	}
+	sentences := make(map[string][]intellexer.Sentence)
+	for _, sentence := range res.Sentences {
+		sentences[sentence.SentimentID] = append(sentences[sentence.SentimentID], sentence)
+	}
+	r := results{
+		full:    res,
+		columns: []string{"id", "weight", "text"},
+		text: func(w io.Writer) {
+			for _, sentiment := range res.Sentiments {
+				fmt.Fprintln(w, sentiment.SentimentWeight)
+			}
+		},
+	}
+	for _, sentiment := range res.Sentiments {
+		text := texts[sentiment.ID]
+		r.rows = append(r.rows, []string{sentiment.ID, formatWeight(sentiment.SentimentWeight), text})
+		r.records = append(r.records, reviewResult{
+			ID:        sentiment.ID,
+			Text:      text,
+			Weight:    sentiment.SentimentWeight,
+			Sentences: sentences[sentiment.ID],
+		})
+	}
+	return r
+}
+
+type topicResult struct {
+	Rank  int    `json:"rank"`
+	Topic string `json:"topic"`
+}
+
+func topicResults(topics []string) results {
+	r := results{
+		full:    topics,
+		columns: []string{"rank", "topic"},
+		text: func(w io.Writer) {
+			for i, topic := range topics {
+				fmt.Fprintf(w, "Topic %d: %s\n", i+1, topic)
+			}
+		},
+	}
+	for i, topic := range topics {
+		r.rows = append(r.rows, []string{strconv.Itoa(i + 1), topic})
+		r.records = append(r.records, topicResult{Rank: i + 1, Topic: topic})
+	}
+	return r
+}
+
+type ontologyResult struct {
+	Ontology intellexer.Ontology `json:"ontology"`
+}
+
+func ontologyResults(ontologies []intellexer.Ontology) results {
+	r := results{
+		full:    ontologies,
+		columns: []string{"ontology"},
+		text: func(w io.Writer) {
+			for _, ontology := range ontologies {
+				fmt.Fprintln(w, ontology)
+			}
+		},
+	}
+	for _, ontology := range ontologies {
+		r.rows = append(r.rows, []string{string(ontology)})
+		r.records = append(r.records, ontologyResult{ontology})
+	}
+	return r
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/amccarthy1/intellexer"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	formatReviews  = []intellexer.Review{{ID: "1", Text: "Great, really"}, {ID: "22", Text: "Bad"}}
+	formatResponse = &intellexer.SentimentResponse{
+		SentimentsCount: 2,
+		Ontology:        intellexer.Hotels,
+		Sentences: []intellexer.Sentence{
+			{SentimentID: "1", Text: `<pos w="2">Great</pos>, really`, SentimentWeight: 2},
+		},
+		Sentiments: []intellexer.Sentiment{
+			{ID: "1", SentimentWeight: 2},
+			{ID: "22", SentimentWeight: -1.5},
+		},
+	}
+)
+
+func writeResults(t *testing.T, r results, format string) string {
+	var buf bytes.Buffer
+	assert.Nil(t, r.write(&buf, format))
+	return buf.String()
+}
+
+func TestSentimentFormats(t *testing.T) {
+	r := sentimentResults(formatReviews, formatResponse)
+	assert.Equal(t, "2\n-1.5\n", writeResults(t, r, "text"))
+	assert.Equal(t, "id,weight,text\n1,2,\"Great, really\"\n22,-1.5,Bad\n", writeResults(t, r, "csv"))
+	assert.Equal(t, "ID  WEIGHT  TEXT\n1   2       Great, really\n22  -1.5    Bad\n", writeResults(t, r, "table"))
+	assert.Equal(
+		t,
+		`{"id":"1","text":"Great, really","weight":2,"sentences":[{"sid":"1","text":"<pos w=\"2\">Great</pos>, really","w":2}]}`+"\n"+
+			`{"id":"22","text":"Bad","weight":-1.5}`+"\n",
+		writeResults(t, r, "ndjson"),
+	)
+	json := writeResults(t, r, "json")
+	assert.Contains(t, json, `"sentimentsCount": 2,`)
+	assert.Contains(t, json, "\n  \"ontology\": \"hotels\",")
+}
+
+func TestTopicAndOntologyFormats(t *testing.T) {
+	r := topicResults([]string{"Health.healthcare", "Tech.information_technology"})
+	assert.Equal(t, "Topic 1: Health.healthcare\nTopic 2: Tech.information_technology\n", writeResults(t, r, "text"))
+	assert.Equal(t, "rank,topic\n1,Health.healthcare\n2,Tech.information_technology\n", writeResults(t, r, "csv"))
+	assert.Equal(t, `{"rank":1,"topic":"Health.healthcare"}`+"\n"+`{"rank":2,"topic":"Tech.information_technology"}`+"\n", writeResults(t, r, "ndjson"))
+	assert.Equal(t, "[\n  \"Health.healthcare\",\n  \"Tech.information_technology\"\n]\n", writeResults(t, r, "json"))
+
+	r = ontologyResults([]intellexer.Ontology{"Hotels", "Gadgets"})
+	assert.Equal(t, "ONTOLOGY\nHotels\nGadgets\n", writeResults(t, r, "table"))
+	assert.Equal(t, `{"ontology":"Hotels"}`+"\n"+`{"ontology":"Gadgets"}`+"\n", writeResults(t, r, "ndjson"))
+}
+
+func TestMergeSentiments(t *testing.T) {
+	text := func(s string) *string { return &s }
+	batch := func(id string, weight float64) *intellexer.SentimentResponse {
+		return &intellexer.SentimentResponse{
+			SentimentsCount: 1,
+			Sentences:       []intellexer.Sentence{{SentimentID: id}},
+			Sentiments:      []intellexer.Sentiment{{ID: id}},
+			Opinions: intellexer.Opinion{Children: []intellexer.Opinion{
+				{Text: text("Drinks"), F: 1, RS: []int{1}, SentimentWeight: weight, Children: []intellexer.Opinion{
+					{Text: text(id), F: 1, RS: []int{1}, SentimentWeight: weight},
+				}},
+			}},
+		}
+	}
+	merged := mergeSentiments(nil, batch("a", 3))
+	merged = mergeSentiments(merged, batch("b", -1))
+	merged = mergeSentiments(merged, batch("c", 1))
+
+	assert.Equal(t, 3, merged.SentimentsCount)
+	assert.Len(t, merged.Sentences, 3)
+	if assert.Len(t, merged.Opinions.Children, 1) {
+		drinks := merged.Opinions.Children[0]
+		assert.Equal(t, "Drinks", *drinks.Text)
+		assert.Equal(t, 3, drinks.F)
+		assert.Equal(t, 1.0, drinks.SentimentWeight)
+		assert.Equal(t, []int{1, 2, 3}, drinks.RS)
+		if assert.Len(t, drinks.Children, 3) {
+			// Each sentence number still points at its own review's sentence
+			for _, child := range drinks.Children {
+				assert.Equal(t, *child.Text, merged.Sentences[child.RS[0]-1].SentimentID)
+			}
+		}
+	}
+}
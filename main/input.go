@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/amccarthy1/intellexer"
+	"github.com/google/uuid"
+)
+
+// inputFormats are the supported formats for reading reviews from a file:
+//   - lines: one review per line, IDs are line numbers
+//   - csv: a CSV file with a header row, with ID and text columns chosen by name
+//   - jsonl: one JSON review object per line, as sent to the API
+var inputFormats = []string{"lines", "csv", "jsonl"}
+
+// reviewReader reads reviews one at a time, returning io.EOF when done.
+type reviewReader interface {
+	Next() (intellexer.Review, error)
+}
+
+// newReviewReader returns a reader for the given input format.
+func newReviewReader(r io.Reader, format, idColumn, textColumn string) (reviewReader, error) {
+	switch format {
+	case "lines":
+		return &lineReader{scanner: bufio.NewScanner(r)}, nil
+	case "csv":
+		return newCSVReader(r, idColumn, textColumn)
+	case "jsonl":
+		return &jsonlReader{decoder: json.NewDecoder(r)}, nil
+	}
+	return nil, usageError{fmt.Sprintf("unknown input format %q (expected one of %s)", format, strings.Join(inputFormats, ", "))}
+}
+
+type lineReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// Next returns the next non-blank line, with its line number as the ID.
+func (lr *lineReader) Next() (intellexer.Review, error) {
+	for lr.scanner.Scan() {
+		lr.line++
+		text := strings.TrimSpace(lr.scanner.Text())
+		if len(text) > 0 {
+			return intellexer.Review{ID: strconv.Itoa(lr.line), Text: text}, nil
+		}
+	}
+	if err := lr.scanner.Err(); err != nil {
+		return intellexer.Review{}, err
+	}
+	return intellexer.Review{}, io.EOF
+}
+
+type csvReader struct {
+	reader  *csv.Reader
+	idIndex int
+	text    int
+	row     int
+}
+
+// newCSVReader reads the header row and finds the ID and text columns. If
+// idColumn is empty, row numbers are used as IDs.
+func newCSVReader(r io.Reader, idColumn, textColumn string) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("CSV input is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	cr := &csvReader{reader: reader, idIndex: -1, text: -1}
+	for i, column := range header {
+		switch strings.TrimSpace(column) {
+		case idColumn:
+			cr.idIndex = i
+		case textColumn:
+			cr.text = i
+		}
+	}
+	if cr.text < 0 {
+		return nil, fmt.Errorf("CSV input has no %q column", textColumn)
+	}
+	if len(idColumn) > 0 && cr.idIndex < 0 {
+		return nil, fmt.Errorf("CSV input has no %q column", idColumn)
+	}
+	return cr, nil
+}
+
+func (cr *csvReader) Next() (intellexer.Review, error) {
+	record, err := cr.reader.Read()
+	if err != nil {
+		return intellexer.Review{}, err
+	}
+	cr.row++
+	if cr.text >= len(record) {
+		return intellexer.Review{}, fmt.Errorf("CSV row %d has no text column", cr.row)
+	}
+	review := intellexer.Review{ID: strconv.Itoa(cr.row), Text: record[cr.text]}
+	if cr.idIndex >= 0 && cr.idIndex < len(record) {
+		review.ID = record[cr.idIndex]
+	}
+	return review, nil
+}
+
+type jsonlReader struct {
+	decoder *json.Decoder
+	line    int
+}
+
+// Next decodes the next review. Reviews without an ID get a random UUID.
+func (jr *jsonlReader) Next() (intellexer.Review, error) {
+	var review intellexer.Review
+	if err := jr.decoder.Decode(&review); err != nil {
+		if err == io.EOF {
+			return review, err
+		}
+		return review, fmt.Errorf("invalid JSON review after %d reviews: %v", jr.line, err)
+	}
+	jr.line++
+	if len(review.ID) == 0 {
+		review.ID = uuid.New().String()
+	}
+	return review, nil
+}
+
+// argsReader serves reviews given on the command line, with random IDs.
+type argsReader struct {
+	args []string
+}
+
+func (ar *argsReader) Next() (intellexer.Review, error) {
+	if len(ar.args) == 0 {
+		return intellexer.Review{}, io.EOF
+	}
+	text := ar.args[0]
+	ar.args = ar.args[1:]
+	return intellexer.Review{ID: uuid.New().String(), Text: text}, nil
+}
+
+// batcher groups reviews into batches small enough to send in one request,
+// limiting both the number of reviews and the total length of their text.
+type batcher struct {
+	reader   reviewReader
+	maxCount int
+	maxBytes int
+	pending  *intellexer.Review
+}
+
+// Next returns the next batch, or io.EOF once every review has been read.
+func (b *batcher) Next() ([]intellexer.Review, error) {
+	var batch []intellexer.Review
+	size := 0
+	for b.maxCount <= 0 || len(batch) < b.maxCount {
+		var review intellexer.Review
+		if b.pending != nil {
+			review, b.pending = *b.pending, nil
+		} else {
+			var err error
+			review, err = b.reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		// A single review larger than the limit still gets its own batch.
+		if b.maxBytes > 0 && len(batch) > 0 && size+len(review.Text) > b.maxBytes {
+			b.pending = &review
+			break
+		}
+		batch = append(batch, review)
+		size += len(review.Text)
+	}
+	if len(batch) == 0 {
+		return nil, io.EOF
+	}
+	return batch, nil
+}
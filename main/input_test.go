@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/amccarthy1/intellexer"
+	"github.com/amccarthy1/intellexer/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func readAll(t *testing.T, reader reviewReader) []intellexer.Review {
+	var reviews []intellexer.Review
+	for {
+		review, err := reader.Next()
+		if err == io.EOF {
+			return reviews
+		}
+		assert.Nil(t, err)
+		reviews = append(reviews, review)
+	}
+}
+
+func TestLineReader(t *testing.T) {
+	reader, err := newReviewReader(strings.NewReader("first\n\n  second  \n"), "lines", "", "")
+	assert.Nil(t, err)
+	assert.Equal(t, []intellexer.Review{{ID: "1", Text: "first"}, {ID: "3", Text: "second"}}, readAll(t, reader))
+}
+
+func TestCSVReader(t *testing.T) {
+	input := "review_id,body,stars\nabc,\"Great, really\",5\ndef,Bad,1\n"
+	reader, err := newReviewReader(strings.NewReader(input), "csv", "review_id", "body")
+	assert.Nil(t, err)
+	assert.Equal(t, []intellexer.Review{{ID: "abc", Text: "Great, really"}, {ID: "def", Text: "Bad"}}, readAll(t, reader))
+
+	reader, err = newReviewReader(strings.NewReader(input), "csv", "", "body")
+	assert.Nil(t, err)
+	assert.Equal(t, "2", readAll(t, reader)[1].ID)
+
+	_, err = newReviewReader(strings.NewReader(input), "csv", "id", "body")
+	assert.Equal(t, `CSV input has no "id" column`, err.Error())
+	_, err = newReviewReader(strings.NewReader(""), "csv", "id", "text")
+	assert.NotNil(t, err)
+}
+
+func TestJSONLReader(t *testing.T) {
+	input := `{"id":"1","text":"foo","author":"jdoe"}` + "\n" + `{"text":"bar"}` + "\n"
+	reader, err := newReviewReader(strings.NewReader(input), "jsonl", "", "")
+	assert.Nil(t, err)
+	reviews := readAll(t, reader)
+	assert.Len(t, reviews, 2)
+	assert.Equal(t, intellexer.Review{ID: "1", Text: "foo", Author: "jdoe"}, reviews[0])
+	assert.Len(t, reviews[1].ID, 36)
+
+	reader, err = newReviewReader(strings.NewReader(`{"id":`), "jsonl", "", "")
+	assert.Nil(t, err)
+	_, err = reader.Next()
+	assert.Contains(t, err.Error(), "invalid JSON review")
+
+	_, err = newReviewReader(strings.NewReader(""), "xml", "", "")
+	assert.IsType(t, usageError{}, err)
+}
+
+func TestBatcher(t *testing.T) {
+	reader := &argsReader{args: []string{"aaaa", "bb", "cc", "dddddddd", "e"}}
+	batches := &batcher{reader: reader, maxCount: 2, maxBytes: 6}
+	var sizes []int
+	for {
+		batch, err := batches.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		sizes = append(sizes, len(batch))
+	}
+	// [aaaa bb] [cc] [dddddddd] [e]: "cc" + "dddddddd" is too long, and
+	// "dddddddd" is over the limit on its own but still sent
+	assert.Equal(t, []int{2, 1, 1, 1}, sizes)
+}
+
+func TestBatchMode(t *testing.T) {
+	server := mocks.NewFakeServer("secret")
+	defer server.Close()
+	env := map[string]string{"API_KEY": "secret"}
+
+	code, stdout, stderr := runCLIWithEnv(t, env, server.URL, "I love it\nterrible\nneat\n",
+		"analyze_sentiments", "--input", "-", "--batch-size", "2", "--format", "csv")
+	assert.Equal(t, exitOK, code, stderr)
+	assert.Equal(t, "id,weight,text\n1,3,I love it\n2,-3,terrible\n3,1,neat\n", stdout)
+
+	// Several batches still make a single JSON document
+	code, stdout, _ = runCLIWithEnv(t, env, server.URL, "I love it\nterrible\nneat\n",
+		"analyze_sentiments", "--input", "-", "--batch-size", "2", "--format", "json")
+	assert.Equal(t, exitOK, code)
+	var res intellexer.SentimentResponse
+	assert.Nil(t, json.Unmarshal([]byte(stdout), &res), stdout)
+	assert.Equal(t, 3, res.SentimentsCount)
+	assert.Len(t, res.Sentiments, 3)
+
+	code, stdout, _ = runCLIWithEnv(t, env, server.URL, "review_id,body\nx,great\n",
+		"analyze_sentiments", "--input", "-", "--input-format", "csv", "--id-column", "review_id", "--text-column", "body", "--format", "ndjson")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, `"id":"x","text":"great","weight":2`)
+
+	code, _, stderr = runCLIWithEnv(t, env, server.URL, "", "analyze_sentiments", "--input", "-", "extra arg")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "can't be given as arguments")
+}
@@ -3,96 +3,233 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/amccarthy1/intellexer"
-	"github.com/google/uuid"
 )
 
-type subcommand func(client *intellexer.Client)
+// Exit codes
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+const defaultTimeout = 30 * time.Second
+
+// usageError is returned for invalid command lines. It makes the CLI print the
+// usage of the command and exit with exitUsage.
+type usageError struct {
+	msg string
+}
+
+func (err usageError) Error() string {
+	return err.msg
+}
+
+// environment is everything a command needs to run.
+type environment struct {
+	ctx    context.Context
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	client *intellexer.Client
+	format string
+}
 
-var subCommands = map[string]subcommand{
-	"analyze_sentiments":  analyzeSentiments,
-	"get_topics":          getTopics,
-	"get_topics_from_url": getTopicsFromURL,
+// runFunc runs a command with its positional arguments.
+type runFunc func(env *environment, args []string) error
+
+// command is a CLI subcommand.
+type command struct {
+	name    string
+	args    string
+	summary string
+	// setup registers the command's own flags, and returns the function that
+	// runs it once the flags have been parsed.
+	setup func(fs *flag.FlagSet) runFunc
+}
+
+// globalFlags are the flags shared by every command.
+type globalFlags struct {
+	baseURL string
+	timeout time.Duration
+	format  string
+	profile string
+	config  string
+}
+
+func (g *globalFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&g.baseURL, "base-url", "", "override the API base URL")
+	fs.DurationVar(&g.timeout, "timeout", defaultTimeout, "timeout for each API request")
+	fs.StringVar(&g.format, "format", "text", "output format ("+strings.Join(formats, ", ")+")")
+	fs.StringVar(&g.profile, "profile", "", "profile of the config file to use")
+	fs.StringVar(&g.config, "config", "", "path of the config file")
 }
 
-func usage() {
-	fmt.Println("Usage: intellexer [subcommand] (...args)")
-	fmt.Println("Where subcommand is one of:")
-	for option := range subCommands {
-		fmt.Printf("\t%s\n", option)
+func commandNames() []string {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
 }
 
-func analyzeSentiments(client *intellexer.Client) {
-	if len(os.Args) < 3 {
-		fmt.Println("Usage: intellexer analyze_sentiments [review] (...[reviews])")
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: intellexer <command> [flags] [args...]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, name := range commandNames() {
+		fmt.Fprintf(w, "  %-22s %s\n", name, commands[name].summary)
 	}
-	var reviews []intellexer.Review
-	for _, review := range os.Args[2:] {
-		reviews = append(reviews, intellexer.Review{
-			ID:   uuid.New(),
-			Text: review,
-		})
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'intellexer help <command>' for the flags of a command.")
+	fmt.Fprintln(w, "The API key is read from the API_KEY environment variable, or from the")
+	fmt.Fprintln(w, "profile selected with --profile in the config file.")
+}
+
+func newFlagSet(cmd *command, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: intellexer %s [flags] %s\n\n%s\n\nFlags:\n", cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
 	}
-	res, err := client.AnalyzeSentiments(intellexer.Gadgets, reviews)
-	if err != nil {
-		panic(err)
+	return fs
+}
+
+// run runs the CLI with the given arguments (excluding the program name) and
+// returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer, getenv func(string) (string, bool)) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
 	}
-	for _, sentiment := range res.Sentiments {
-		fmt.Println(sentiment.SentimentWeight)
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		return help(args[1:], stdout, stderr)
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "intellexer: unknown command %q\n\n", name)
+		usage(stderr)
+		return exitUsage
 	}
-}
 
-func getTopics(client *intellexer.Client) {
-	if len(os.Args) != 3 {
-		fmt.Println("Usage: intellexer get_topics [path/to/article]")
+	fs := newFlagSet(cmd, stderr)
+	var global globalFlags
+	global.register(fs)
+	runCmd := cmd.setup(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
 	}
-	file, err := os.Open(os.Args[2])
+
+	cfg, err := loadConfig(global.config, getenv)
 	if err != nil {
-		panic(err)
+		fmt.Fprintf(stderr, "intellexer: %v\n", err)
+		return exitError
 	}
-	topics, err := client.GetTopics(file)
+	prof, err := cfg.profile(global.profile, getenv)
 	if err != nil {
-		panic(err)
+		fmt.Fprintf(stderr, "intellexer: %v\n", err)
+		return exitError
 	}
-	for i, topic := range topics {
-		fmt.Printf("Topic %d: %s\n", i+1, topic)
+	if err := applyProfile(fs, prof, getenv); err != nil {
+		fmt.Fprintf(stderr, "intellexer: %v\n", err)
+		return exitError
 	}
-}
 
-func getTopicsFromURL(client *intellexer.Client) {
-	if len(os.Args) != 3 {
-		fmt.Println("Usage: intellexer get_topics_from_url [url]")
+	if !isValidFormat(global.format) {
+		fmt.Fprintf(stderr, "intellexer %s: unknown format %q\n", name, global.format)
+		fs.Usage()
+		return exitUsage
 	}
-	topics, err := client.GetTopicsFromURL(os.Args[2])
+
+	provider, err := credentials(prof, getenv)
 	if err != nil {
-		panic(err)
+		fmt.Fprintf(stderr, "intellexer: %v\n", err)
+		return exitError
 	}
-	for i, topic := range topics {
-		fmt.Printf("Topic %d: %s\n", i+1, topic)
+	client := intellexer.NewClient("").
+		WithHTTPClient(&http.Client{Timeout: global.timeout}).
+		WithCredentials(provider)
+	if len(global.baseURL) > 0 {
+		client.WithBaseURL(global.baseURL)
 	}
+	// Commands stop what they are doing when interrupted
+	ctx, stop := notifyContext(os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	env := &environment{
+		ctx:    ctx,
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+		client: client,
+		format: global.format,
+	}
+	if err := runCmd(env, fs.Args()); err != nil {
+		fmt.Fprintf(stderr, "intellexer %s: %v\n", name, err)
+		if _, ok := err.(usageError); ok {
+			fs.Usage()
+			return exitUsage
+		}
+		return exitError
+	}
+	return exitOK
 }
 
-func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("No arguments given")
-		os.Exit(1)
+// notifyContext returns a context that is cancelled when one of the signals
+// arrives, like signal.NotifyContext, which needs Go 1.16.
+func notifyContext(signals ...os.Signal) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	go func() {
+		select {
+		case <-ch:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(ch)
+		cancel()
 	}
-	apiKey, found := os.LookupEnv("API_KEY")
-	if !found {
-		panic("No API key given! Please run with API_KEY={api_key_here}")
+}
+
+func help(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stdout)
+		return exitOK
 	}
-	client := intellexer.NewClient(apiKey).WithHTTPClient(http.DefaultClient)
-	subCommandStr := os.Args[1]
-	subCommand, ok := subCommands[subCommandStr]
+	cmd, ok := commands[args[0]]
 	if !ok {
-		// TODO implement usage
-		fmt.Printf("Invalid command: %s\n", subCommandStr)
-		usage()
+		fmt.Fprintf(stderr, "intellexer: unknown command %q\n\n", args[0])
+		usage(stderr)
+		return exitUsage
 	}
-	subCommand(client)
+	fs := newFlagSet(cmd, stdout)
+	var global globalFlags
+	global.register(fs)
+	cmd.setup(fs)
+	fs.Usage()
+	return exitOK
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr, os.LookupEnv))
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/amccarthy1/intellexer/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// runCLI runs the CLI against a fake server and returns the exit code, stdout
+// and stderr.
+func runCLI(t *testing.T, args ...string) (int, string, string) {
+	server := mocks.NewFakeServer("secret")
+	defer server.Close()
+	return runCLIWithEnv(t, map[string]string{"API_KEY": "secret"}, server.URL, "", args...)
+}
+
+func runCLIWithEnv(t *testing.T, env map[string]string, baseURL, stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	if _, ok := commands[firstArg(args)]; ok && len(baseURL) > 0 {
+		args = append([]string{args[0], "--base-url", baseURL}, args[1:]...)
+	}
+	getenv := func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr, getenv)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestAnalyzeSentiments(t *testing.T) {
+	code, stdout, stderr := runCLI(t, "analyze_sentiments", "--ontology", "hotels", "I love it", "terrible")
+	assert.Equal(t, exitOK, code, stderr)
+	assert.Equal(t, "3\n-3\n", stdout)
+
+	code, stdout, _ = runCLI(t, "analyze_sentiments", "--format", "json", "neat")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, `"ontology": "gadgets"`)
+}
+
+func TestTopicsAndOntologies(t *testing.T) {
+	code, stdout, _ := runCLI(t, "get_topics_from_url", "http://example.com/health")
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "Topic 1: Health.healthcare\n", stdout)
+
+	code, stdout, _ = runCLI(t, "get_topics", "../testdata/get_topics_response.json")
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "Topic 1: Health.healthcare\nTopic 2: Tech.information_technology\n", stdout)
+
+	code, stdout, _ = runCLI(t, "list_ontologies")
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "Hotels\nRestaurants\nGadgets\n", stdout)
+}
+
+func TestErrors(t *testing.T) {
+	code, _, stderr := runCLI(t)
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "Usage: intellexer <command>")
+
+	code, _, stderr = runCLI(t, "bogus")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, `unknown command "bogus"`)
+
+	code, _, stderr = runCLI(t, "analyze_sentiments")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "at least one review is required")
+
+	code, _, stderr = runCLI(t, "list_ontologies", "--format", "xml")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, `unknown format "xml"`)
+
+	code, _, stderr = runCLI(t, "analyze_sentiments", "--ontology", "cars", "neat")
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, "Request Error")
+
+	code, _, stderr = runCLI(t, "get_topics", "does/not/exist")
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, "no such file")
+
+	code, _, stderr = runCLIWithEnv(t, nil, "", "", "list_ontologies")
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, "no API key given")
+}
+
+func TestHelp(t *testing.T) {
+	code, stdout, _ := runCLI(t, "help")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, "list_ontologies")
+
+	code, stdout, _ = runCLI(t, "help", "analyze_sentiments")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, "-ontology")
+	assert.Contains(t, stdout, "-timeout")
+
+	code, _, stderr := runCLI(t, "analyze_sentiments", "-h")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stderr, "Usage: intellexer analyze_sentiments")
+}
+
+func firstArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
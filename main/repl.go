@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/amccarthy1/intellexer"
+	"github.com/google/uuid"
+)
+
+// ANSI escape codes used to color terminal output.
+const (
+	ansiReset = "\x1b[0m"
+	ansiGreen = "\x1b[32m"
+	ansiRed   = "\x1b[31m"
+	ansiDim   = "\x1b[2m"
+)
+
+// isTerminal reports whether w is a terminal, so escape codes can be used.
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// annotationPattern matches the <pos> and <neg> tags the API wraps key phrases
+// of a sentence in.
+var annotationPattern = regexp.MustCompile(`<(pos|neg)(?:\s+w="([^"]*)")?\s*>(.*?)</(?:pos|neg)>`)
+
+// highlight replaces the annotations in a sentence with colored text (or
+// bracketed text if color is false), followed by the phrase weight.
+func highlight(sentence string, color bool) string {
+	return annotationPattern.ReplaceAllStringFunc(sentence, func(match string) string {
+		parts := annotationPattern.FindStringSubmatch(match)
+		polarity, weight, text := parts[1], parts[2], parts[3]
+		if len(weight) > 0 {
+			text = fmt.Sprintf("%s(%s)", text, weight)
+		}
+		switch {
+		case !color && polarity == "pos":
+			return "[+" + text + "]"
+		case !color:
+			return "[-" + text + "]"
+		case polarity == "pos":
+			return ansiGreen + text + ansiReset
+		}
+		return ansiRed + text + ansiReset
+	})
+}
+
+const replHelp = `Type any text to analyze its sentiment, or one of:
+  :ontology [name]  show or switch the ontology
+  :tree             show the opinion tree of the last analysis
+  :topics <text>    extract the topics of the text
+  :history          show the session history
+  :help             show this help
+  :quit             exit (or Ctrl-D)
+`
+
+// historyEntry is one input of a REPL session and a short summary of its
+// result.
+type historyEntry struct {
+	input   string
+	summary string
+}
+
+// repl is an interactive session.
+type repl struct {
+	env        *environment
+	color      bool
+	ontology   intellexer.Ontology
+	last       *intellexer.SentimentResponse
+	history    []historyEntry
+	classifier intellexer.Classifier
+}
+
+func setupREPL(fs *flag.FlagSet) runFunc {
+	ontology := fs.String("ontology", string(intellexer.Gadgets), "initial ontology")
+	noColor := fs.Bool("no-color", false, "disable colored output (it is only used on terminals anyway)")
+	return func(env *environment, args []string) error {
+		if len(args) != 0 {
+			return usageError{"repl takes no arguments"}
+		}
+		r := &repl{
+			env:        env,
+			color:      !*noColor && isTerminal(env.stdout),
+			ontology:   intellexer.Ontology(*ontology),
+			classifier: intellexer.DefaultClassifier,
+		}
+		return r.run()
+	}
+}
+
+func (r *repl) run() error {
+	out := r.env.stdout
+	fmt.Fprintf(out, "Intellexer REPL, ontology %s. Type :help for help.\n", r.ontology)
+	scanner := bufio.NewScanner(r.env.stdin)
+	for {
+		fmt.Fprintf(out, "%s> ", r.ontology)
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		if line == ":quit" || line == ":q" || line == ":exit" {
+			return nil
+		}
+		summary, err := r.eval(line)
+		if err != nil {
+			// Errors don't end the session
+			fmt.Fprintf(out, "error: %v\n", err)
+			summary = "error"
+		}
+		r.history = append(r.history, historyEntry{input: line, summary: summary})
+	}
+}
+
+// eval runs one line of input and returns a summary for the history.
+func (r *repl) eval(line string) (string, error) {
+	if !strings.HasPrefix(line, ":") {
+		return r.analyze(line)
+	}
+	command, arg := line, ""
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		command, arg = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	out := r.env.stdout
+	switch command {
+	case ":help":
+		fmt.Fprint(out, replHelp)
+		return "", nil
+	case ":ontology":
+		if len(arg) > 0 {
+			r.ontology = intellexer.Ontology(strings.ToLower(arg))
+		}
+		fmt.Fprintf(out, "ontology: %s\n", r.ontology)
+		return string(r.ontology), nil
+	case ":tree":
+		if r.last == nil {
+			return "", fmt.Errorf("nothing analyzed yet")
+		}
+		writeTree(out, r.last.Opinions, r.color)
+		return "", nil
+	case ":topics":
+		if len(arg) == 0 {
+			return "", fmt.Errorf(":topics needs some text")
+		}
+		topics, err := r.env.client.GetTopicsFromText(arg)
+		if err != nil {
+			return "", err
+		}
+		if len(topics) == 0 {
+			fmt.Fprintln(out, "no topics")
+		}
+		for _, topic := range topics {
+			fmt.Fprintln(out, topic)
+		}
+		return strings.Join(topics, ", "), nil
+	case ":history":
+		for i, entry := range r.history {
+			fmt.Fprintf(out, "%3d  %s", i+1, entry.input)
+			if len(entry.summary) > 0 {
+				fmt.Fprintf(out, "  => %s", entry.summary)
+			}
+			fmt.Fprintln(out)
+		}
+		return "", nil
+	}
+	return "", fmt.Errorf("unknown command %s, type :help for help", command)
+}
+
+func (r *repl) analyze(text string) (string, error) {
+	review := intellexer.Review{ID: uuid.New().String(), Text: text}
+	res, err := r.env.client.AnalyzeSentiments(r.ontology, []intellexer.Review{review})
+	if err != nil {
+		return "", err
+	}
+	r.last = res
+	out := r.env.stdout
+	var weight float64
+	if len(res.Sentiments) > 0 {
+		weight = res.Sentiments[0].SentimentWeight
+	}
+	summary := fmt.Sprintf("%s (%s)", strconv.FormatFloat(weight, 'f', -1, 64), r.classifier.Classify(weight))
+	fmt.Fprintf(out, "sentiment: %s, %.1f stars\n", summary, r.classifier.Stars(weight))
+	for _, sentence := range res.Sentences {
+		fmt.Fprintf(out, "  %s", highlight(sentence.Text, r.color))
+		if r.color {
+			fmt.Fprintf(out, " %s%g%s\n", ansiDim, sentence.SentimentWeight, ansiReset)
+		} else {
+			fmt.Fprintf(out, " (%g)\n", sentence.SentimentWeight)
+		}
+	}
+	return summary, nil
+}
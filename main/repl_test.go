@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/amccarthy1/intellexer/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHighlight(t *testing.T) {
+	sentence := `I <pos w="2">love</pos> it but the food was <neg>bad</neg>`
+	assert.Equal(t, "I [+love(2)] it but the food was [-bad]", highlight(sentence, false))
+	assert.Equal(t, "I "+ansiGreen+"love(2)"+ansiReset+" it but the food was "+ansiRed+"bad"+ansiReset,
+		highlight(sentence, true))
+}
+
+func TestIsTerminal(t *testing.T) {
+	assert.False(t, isTerminal(&bytes.Buffer{}))
+	file, err := ioutil.TempFile("", "intellexer")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	defer file.Close()
+	assert.False(t, isTerminal(file))
+}
+
+func TestREPL(t *testing.T) {
+	server := mocks.NewFakeServer("secret")
+	defer server.Close()
+	input := "I love it\n:tree\n:ontology hotels\n:topics football match\n:bogus\n:history\n:quit\nignored\n"
+	code, stdout, stderr := runCLIWithEnv(t, map[string]string{"API_KEY": "secret"}, server.URL, input,
+		"repl", "--no-color")
+	assert.Equal(t, exitOK, code, stderr)
+	assert.Contains(t, stdout, "gadgets> sentiment: 3 (strongly positive)")
+	assert.Contains(t, stdout, "ontology: hotels\nhotels> ")
+	assert.Contains(t, stdout, "Sports.football\n")
+	assert.Contains(t, stdout, "error: unknown command :bogus")
+	assert.Contains(t, stdout, "  1  I love it  => 3 (strongly positive)\n")
+	assert.Contains(t, stdout, "  5  :bogus  => error\n")
+	assert.NotContains(t, stdout, "ignored")
+
+	// Piped output is never colored
+	_, stdout, _ = runCLIWithEnv(t, map[string]string{"API_KEY": "secret"}, server.URL, "I love it\n", "repl")
+	assert.Contains(t, stdout, "[+love(3)]")
+	assert.NotContains(t, stdout, "\x1b[")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/amccarthy1/intellexer"
+)
+
+// The requests accepted by the server and rpc commands, which validate them the
+// same way.
+
+// validationError is returned for requests that are invalid, as opposed to
+// requests that failed.
+type validationError string
+
+func (err validationError) Error() string {
+	return string(err)
+}
+
+type topicsRequest struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
+// run extracts the topics of the text or URL of the request.
+func (req topicsRequest) run(ctx context.Context, client *intellexer.Client) ([]string, error) {
+	var topics []string
+	var err error
+	switch {
+	case len(req.Text) > 0 && len(req.URL) > 0:
+		return nil, validationError("give either text or url, not both")
+	case len(req.Text) > 0:
+		topics, err = client.GetTopicsFromUpload(ctx, intellexer.Upload{
+			Body: strings.NewReader(req.Text),
+			Size: int64(len(req.Text)),
+		})
+	case len(req.URL) > 0:
+		topics, err = client.GetTopicsFromURL(req.URL)
+	default:
+		return nil, validationError("text or url is required")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if topics == nil {
+		topics = []string{}
+	}
+	return topics, nil
+}
+
+type sentimentRequest struct {
+	Ontology intellexer.Ontology `json:"ontology"`
+	Reviews  []intellexer.Review `json:"reviews"`
+}
+
+// validate checks the request and returns its ontology in the case the API
+// expects. A maxReviews of 0 means no limit.
+func (req sentimentRequest) validate(maxReviews int) (intellexer.Ontology, error) {
+	ontology := intellexer.Ontology(strings.ToLower(string(req.Ontology)))
+	switch ontology {
+	case intellexer.Hotels, intellexer.Restaurants, intellexer.Gadgets:
+	default:
+		return "", validationError(fmt.Sprintf("unknown ontology %q", req.Ontology))
+	}
+	if len(req.Reviews) == 0 {
+		return "", validationError("at least one review is required")
+	}
+	if maxReviews > 0 && len(req.Reviews) > maxReviews {
+		return "", validationError(fmt.Sprintf("at most %d reviews are allowed", maxReviews))
+	}
+	if err := intellexer.ValidateReviews(req.Reviews); err != nil {
+		return "", err
+	}
+	for i, review := range req.Reviews {
+		if len(strings.TrimSpace(review.Text)) == 0 {
+			return "", validationError(fmt.Sprintf("review at index %d has no text", i))
+		}
+	}
+	return ontology, nil
+}
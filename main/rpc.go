@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/amccarthy1/intellexer"
+	"github.com/pkg/errors"
+)
+
+// JSON-RPC 2.0 error codes. The codes from -32000 to -32099 are reserved for
+// implementation-defined server errors.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+	// rpcRequestFailed is returned when the request to the API couldn't be made.
+	rpcRequestFailed = -32000
+	// rpcAPIError is returned when the API responded with an error status, which
+	// is given in the data of the error.
+	rpcAPIError = -32001
+	// rpcBreakerOpen is returned when the circuit breaker is rejecting requests.
+	rpcBreakerOpen = -32002
+)
+
+func setupRPC(fs *flag.FlagSet) runFunc {
+	listen := fs.String("listen", "", "serve on this TCP address instead of stdin and stdout")
+	batchSize := fs.Int("batch-size", 100, "maximum number of reviews per API request in analyzeSentiments")
+	maxMessage := fs.Int("max-message", 1<<20, "maximum size of a message in bytes")
+	maxInFlight := fs.Int("max-in-flight", 16, "maximum number of requests handled at once on each connection")
+	return func(env *environment, args []string) error {
+		if len(args) != 0 {
+			return usageError{"rpc takes no arguments"}
+		}
+		if *batchSize < 1 {
+			return usageError{"--batch-size must be at least 1"}
+		}
+		if *maxMessage < 1 || *maxInFlight < 1 {
+			return usageError{"--max-message and --max-in-flight must be at least 1"}
+		}
+		s := &rpcServer{client: env.client, batchSize: *batchSize, maxMessage: *maxMessage, maxInFlight: *maxInFlight}
+		if len(*listen) == 0 {
+			return s.serveConn(env.ctx, env.stdin, env.stdout)
+		}
+		listener, err := net.Listen("tcp", *listen)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(env.stderr, "listening on %s\n", listener.Addr())
+		return s.serve(env.ctx, listener)
+	}
+}
+
+// rpcServer serves the client over JSON-RPC 2.0, with one message per line.
+// The methods are:
+//
+//	topics             {"text": "..."} or {"url": "..."}, returns {"topics": [...]}
+//	ontologies         returns {"ontologies": [...]}
+//	analyzeSentiments  {"ontology": "hotels", "reviews": [{"id": "1", "text": "..."}]},
+//	                   returns the SentimentResponse
+//
+// analyzeSentiments sends the reviews in batches, and sends a progress
+// notification {"id": <request id>, "done": 100, "total": 250} after each one.
+//
+// Messages over maxMessage bytes are rejected, and each connection handles at
+// most maxInFlight requests at once, reading no further messages until one is
+// done.
+type rpcServer struct {
+	client      *intellexer.Client
+	batchSize   int
+	maxMessage  int
+	maxInFlight int
+}
+
+// rpcRequest is a request, or a notification if it has no ID. An ID of null is
+// still a request, and its ID is the JSON null.
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+func (req rpcRequest) isNotification() bool {
+	return len(req.ID) == 0
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (err *rpcError) Error() string {
+	return err.Message
+}
+
+type progress struct {
+	ID    json.RawMessage `json:"id"`
+	Done  int             `json:"done"`
+	Total int             `json:"total"`
+}
+
+// toRPCError maps an error to a JSON-RPC error.
+func toRPCError(err error) *rpcError {
+	switch cause := errors.Cause(err).(type) {
+	case *rpcError:
+		return cause
+	case validationError, intellexer.ReviewIDError, intellexer.DocumentTooLargeError:
+		return &rpcError{Code: rpcInvalidParams, Message: cause.Error()}
+	case intellexer.BreakerOpenError:
+		return &rpcError{Code: rpcBreakerOpen, Message: cause.Error()}
+	case intellexer.APIError:
+		return &rpcError{
+			Code:    rpcAPIError,
+			Message: err.Error(),
+			Data:    map[string]int{"status": cause.Response.StatusCode},
+		}
+	}
+	return &rpcError{Code: rpcRequestFailed, Message: err.Error()}
+}
+
+// serve serves every connection accepted by listener until ctx is done.
+func (s *rpcServer) serve(ctx context.Context, listener net.Listener) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			connCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			// Unblock the read when shutting down
+			go func() {
+				<-connCtx.Done()
+				conn.Close()
+			}()
+			s.serveConn(connCtx, conn, conn)
+		}()
+	}
+}
+
+// rpcConn is one connection. Requests are handled concurrently, so writes are
+// serialized.
+type rpcConn struct {
+	server *rpcServer
+	mu     sync.Mutex
+	w      io.Writer
+}
+
+func (c *rpcConn) send(message interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	newEncoder(c.w).Encode(message)
+}
+
+// serveConn handles the messages read from r until it ends, then waits for
+// the requests in flight.
+func (s *rpcServer) serveConn(ctx context.Context, r io.Reader, w io.Writer) error {
+	c := &rpcConn{server: s, w: w}
+	reader := bufio.NewReader(r)
+	inFlight := make(chan struct{}, s.maxInFlight)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		line, tooLarge, err := readLine(reader, s.maxMessage)
+		if tooLarge {
+			c.send(rpcResponse{
+				JSONRPC: "2.0",
+				Error:   &rpcError{Code: rpcInvalidRequest, Message: fmt.Sprintf("Message larger than %d bytes", s.maxMessage)},
+			})
+		} else if line = bytes.TrimSpace(line); len(line) > 0 {
+			requests, batch, ok := c.parse(line)
+			// A batch takes a slot for each of its requests, up to all of them
+			slots := len(requests)
+			if slots > cap(inFlight) {
+				slots = cap(inFlight)
+			}
+			for i := 0; i < slots; i++ {
+				select {
+				case inFlight <- struct{}{}:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+			if ok {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					c.handleMessage(ctx, requests, batch, slots)
+					for i := 0; i < slots; i++ {
+						<-inFlight
+					}
+				}()
+			}
+		}
+		if err == io.EOF || ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readLine reads a line of at most max bytes. Longer lines are skipped, and
+// reported with tooLarge.
+func readLine(reader *bufio.Reader, max int) (line []byte, tooLarge bool, err error) {
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !tooLarge {
+			if len(line)+len(chunk) > max {
+				tooLarge, line = true, nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if err != bufio.ErrBufferFull {
+			return line, tooLarge, err
+		}
+	}
+}
+
+// parse splits a message into its requests, responding to it straight away if
+// it is invalid.
+func (c *rpcConn) parse(message []byte) (requests []json.RawMessage, batch, ok bool) {
+	if !json.Valid(message) {
+		c.send(rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: rpcParseError, Message: "Parse error"}})
+		return nil, false, false
+	}
+	if message[0] != '[' {
+		return []json.RawMessage{message}, false, true
+	}
+	if err := json.Unmarshal(message, &requests); err != nil || len(requests) == 0 {
+		c.send(rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: rpcInvalidRequest, Message: "Invalid Request"}})
+		return nil, true, false
+	}
+	return requests, true, true
+}
+
+// handleMessage handles the requests of a message, at most workers at a time,
+// and sends the responses.
+func (c *rpcConn) handleMessage(ctx context.Context, requests []json.RawMessage, batch bool, workers int) {
+	if !batch {
+		if res := c.handle(ctx, requests[0]); res != nil {
+			c.send(res)
+		}
+		return
+	}
+	responses := make([]*rpcResponse, len(requests))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, raw := range requests {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, raw json.RawMessage) {
+			defer wg.Done()
+			responses[i] = c.handle(ctx, raw)
+			<-sem
+		}(i, raw)
+	}
+	wg.Wait()
+	// Notifications get no response, and if the batch was only notifications
+	// nothing is sent at all.
+	var results []*rpcResponse
+	for _, res := range responses {
+		if res != nil {
+			results = append(results, res)
+		}
+	}
+	if len(results) > 0 {
+		c.send(results)
+	}
+}
+
+// handle handles a single request, returning nil for notifications.
+func (c *rpcConn) handle(ctx context.Context, raw json.RawMessage) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil || req.JSONRPC != "2.0" || len(req.Method) == 0 {
+		var id json.RawMessage
+		if err == nil {
+			id = req.ID
+		}
+		return &rpcResponse{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: rpcInvalidRequest, Message: "Invalid Request"}}
+	}
+	result, err := c.call(ctx, req)
+	if req.isNotification() {
+		return nil
+	}
+	res := &rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
+	if err != nil {
+		res.Result, res.Error = nil, toRPCError(err)
+	}
+	return res
+}
+
+// decodeParams decodes the params of a request, rejecting unknown fields.
+func decodeParams(params json.RawMessage, out interface{}) error {
+	if len(params) == 0 {
+		return &rpcError{Code: rpcInvalidParams, Message: "params are required"}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(out); err != nil {
+		return &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("Invalid params: %v", err)}
+	}
+	return nil
+}
+
+func (c *rpcConn) call(ctx context.Context, req rpcRequest) (interface{}, error) {
+	client := c.server.client
+	switch req.Method {
+	case "topics":
+		var params topicsRequest
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		topics, err := params.run(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]string{"topics": topics}, nil
+	case "ontologies":
+		ontologies, err := client.ListOntologies()
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]intellexer.Ontology{"ontologies": ontologies}, nil
+	case "analyzeSentiments":
+		var params sentimentRequest
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return c.analyzeSentiments(ctx, req, params)
+	}
+	return nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("Method not found: %s", req.Method)}
+}
+
+// analyzeSentiments analyzes the reviews in batches, sending a progress
+// notification after each batch unless the request is a notification, and
+// combines the responses with mergeSentiments.
+func (c *rpcConn) analyzeSentiments(ctx context.Context, req rpcRequest, params sentimentRequest) (*intellexer.SentimentResponse, error) {
+	ontology, err := params.validate(0)
+	if err != nil {
+		return nil, err
+	}
+	var combined *intellexer.SentimentResponse
+	reviews := params.Reviews
+	for done := 0; done < len(reviews); {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		end := done + c.server.batchSize
+		if end > len(reviews) {
+			end = len(reviews)
+		}
+		res, err := c.server.client.AnalyzeSentiments(ontology, reviews[done:end])
+		if err != nil {
+			return nil, err
+		}
+		combined = mergeSentiments(combined, res)
+		done = end
+		if !req.isNotification() {
+			c.send(rpcNotification{
+				JSONRPC: "2.0",
+				Method:  "progress",
+				Params:  progress{ID: req.ID, Done: done, Total: len(reviews)},
+			})
+		}
+	}
+	return combined, nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amccarthy1/intellexer"
+	"github.com/amccarthy1/intellexer/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// rpcMessages runs a session and returns the messages sent back, responses
+// keyed by ID and progress notifications in order.
+func rpcMessages(t *testing.T, apiKey, input string) (map[string]map[string]interface{}, []string) {
+	fake := mocks.NewFakeServer("secret")
+	defer fake.Close()
+	s := &rpcServer{
+		client:      intellexer.NewClient(apiKey).WithHTTPClient(http.DefaultClient).WithBaseURL(fake.URL),
+		batchSize:   2,
+		maxMessage:  1024,
+		maxInFlight: 4,
+	}
+	var out bytes.Buffer
+	assert.Nil(t, s.serveConn(context.Background(), strings.NewReader(input), &out))
+
+	responses := make(map[string]map[string]interface{})
+	var notifications []string
+	add := func(message map[string]interface{}) {
+		if message["method"] == "progress" {
+			params := message["params"].(map[string]interface{})
+			notifications = append(notifications, fmt.Sprintf("%v %v/%v", params["id"], params["done"], params["total"]))
+			return
+		}
+		responses[fmt.Sprint(message["id"])] = message
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if strings.HasPrefix(line, "[") {
+			var batch []map[string]interface{}
+			assert.Nil(t, json.Unmarshal([]byte(line), &batch), line)
+			for _, message := range batch {
+				add(message)
+			}
+			continue
+		}
+		var message map[string]interface{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &message), line)
+		add(message)
+	}
+	return responses, notifications
+}
+
+func errorCode(res map[string]interface{}) float64 {
+	return res["error"].(map[string]interface{})["code"].(float64)
+}
+
+func TestRPC(t *testing.T) {
+	input := `{"jsonrpc": "2.0", "id": 1, "method": "topics", "params": {"text": "football"}}
+{"jsonrpc": "2.0", "id": "two", "method": "ontologies"}
+{"jsonrpc": "2.0", "id": 3, "method": "analyzeSentiments", "params": {"ontology": "hotels", "reviews": [` +
+		`{"id": "a", "text": "love"}, {"id": "b", "text": "hate"}, {"id": "c", "text": "good"}]}}
+{"jsonrpc": "2.0", "method": "ontologies"}
+[{"jsonrpc": "2.0", "id": 4, "method": "topics", "params": {"url": "http://example.com/tech"}}, {"jsonrpc": "2.0", "method": "ontologies"}]
+[{"jsonrpc": "2.0", "method": "ontologies"}]
+`
+	responses, notifications := rpcMessages(t, "secret", input)
+	assert.Len(t, responses, 4)
+	assert.Equal(t, map[string]interface{}{"topics": []interface{}{"Sports.football"}}, responses["1"]["result"])
+	assert.Equal(t, map[string]interface{}{"ontologies": []interface{}{"Hotels", "Restaurants", "Gadgets"}}, responses["two"]["result"])
+	assert.Equal(t, map[string]interface{}{"topics": []interface{}{"Tech.information_technology"}}, responses["4"]["result"])
+
+	result := responses["3"]["result"].(map[string]interface{})
+	assert.Equal(t, "hotels", result["ontology"])
+	assert.Equal(t, float64(3), result["sentimentsCount"])
+	assert.Len(t, result["sentiments"], 3)
+	assert.Equal(t, []string{"3 2/3", "3 3/3"}, notifications)
+
+	// The opinions of both batches form one tree, with sentence numbers into the
+	// combined sentences
+	responses, _ = rpcMessages(t, "secret", `{"jsonrpc": "2.0", "id": 1, "method": "analyzeSentiments", "params": `+
+		`{"ontology": "hotels", "reviews": [{"id": "a", "text": "love"}, {"id": "b", "text": "hate"}, {"id": "c", "text": "love"}]}}`)
+	opinions := responses["1"]["result"].(map[string]interface{})["opinions"].(map[string]interface{})["children"].([]interface{})
+	if assert.Len(t, opinions, 2) {
+		love := opinions[0].(map[string]interface{})
+		assert.Equal(t, "love", love["t"])
+		assert.Equal(t, []interface{}{float64(1), float64(3)}, love["rs"])
+	}
+
+	// A null ID is still a request
+	responses, _ = rpcMessages(t, "secret", `{"jsonrpc": "2.0", "id": null, "method": "ontologies"}`)
+	if assert.Contains(t, responses, "<nil>") {
+		assert.NotNil(t, responses["<nil>"]["result"])
+	}
+}
+
+func TestRPCErrors(t *testing.T) {
+	input := `{"jsonrpc": "2.0", "id": 1, "method": "nope"}
+{"jsonrpc": "2.0", "id": 2, "method": "topics", "params": {}}
+{"jsonrpc": "2.0", "id": 3, "method": "analyzeSentiments", "params": {"ontology": "cars", "reviews": []}}
+{"jsonrpc": "2.0", "id": 4, "method": "analyzeSentiments", "params": {"ontology": "hotels", "reviews": [{"id": "a", "text": "x"}, {"id": "a", "text": "y"}]}}
+{"jsonrpc": "1.0", "id": 5, "method": "ontologies"}
+{"jsonrpc": "2.0", "id": 6, "method": "topics", "params": {"txt": "typo"}}
+{not json
+[]
+`
+	responses, _ := rpcMessages(t, "secret", input)
+	assert.Equal(t, float64(rpcMethodNotFound), errorCode(responses["1"]))
+	assert.Equal(t, float64(rpcInvalidParams), errorCode(responses["2"]))
+	assert.Equal(t, float64(rpcInvalidParams), errorCode(responses["3"]))
+	assert.Equal(t, float64(rpcInvalidParams), errorCode(responses["4"]))
+	assert.Equal(t, float64(rpcInvalidRequest), errorCode(responses["5"]))
+	assert.Equal(t, float64(rpcInvalidParams), errorCode(responses["6"]))
+	// Both the parse error and the empty batch have a null ID
+	assert.Contains(t, []float64{rpcParseError, rpcInvalidRequest}, errorCode(responses["<nil>"]))
+
+	// Messages over the limit are skipped, and the next ones still handled
+	input = `{"jsonrpc": "2.0", "id": 1, "method": "topics", "params": {"text": "` + strings.Repeat("a", 5000) + `"}}
+{"jsonrpc": "2.0", "id": 2, "method": "ontologies"}
+`
+	responses, _ = rpcMessages(t, "secret", input)
+	assert.Len(t, responses, 2)
+	assert.Equal(t, float64(rpcInvalidRequest), errorCode(responses["<nil>"]))
+	assert.Contains(t, responses["<nil>"]["error"].(map[string]interface{})["message"], "larger than 1024 bytes")
+	assert.NotNil(t, responses["2"]["result"])
+
+	responses, _ = rpcMessages(t, "wrong", `{"jsonrpc": "2.0", "id": 1, "method": "ontologies"}`)
+	rpcErr := responses["1"]["error"].(map[string]interface{})
+	assert.Equal(t, float64(rpcAPIError), rpcErr["code"])
+	assert.Equal(t, map[string]interface{}{"status": float64(401)}, rpcErr["data"])
+	assert.NotContains(t, rpcErr["message"], "wrong")
+}
+
+func TestRPCInFlight(t *testing.T) {
+	var mu sync.Mutex
+	var current, peak int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		current++
+		if current > peak {
+			peak = current
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		current--
+		mu.Unlock()
+		fmt.Fprint(w, `[]`)
+	}))
+	defer upstream.Close()
+	s := &rpcServer{
+		client:      intellexer.NewClient("secret").WithHTTPClient(http.DefaultClient).WithBaseURL(upstream.URL),
+		batchSize:   100,
+		maxMessage:  1024,
+		maxInFlight: 2,
+	}
+	var input strings.Builder
+	for i := 0; i < 6; i++ {
+		fmt.Fprintf(&input, `{"jsonrpc": "2.0", "id": %d, "method": "ontologies"}`+"\n", i)
+	}
+	input.WriteString(`[{"jsonrpc": "2.0", "id": 6, "method": "ontologies"}, {"jsonrpc": "2.0", "id": 7, "method": "ontologies"}, ` +
+		`{"jsonrpc": "2.0", "id": 8, "method": "ontologies"}]` + "\n")
+	var out bytes.Buffer
+	assert.Nil(t, s.serveConn(context.Background(), strings.NewReader(input.String()), &out))
+	assert.Equal(t, 7, strings.Count(out.String(), "\n"))
+	assert.Equal(t, 2, peak)
+}
+
+func TestRPCOverTCP(t *testing.T) {
+	fake := mocks.NewFakeServer("secret")
+	defer fake.Close()
+	s := &rpcServer{
+		client:      intellexer.NewClient("secret").WithHTTPClient(http.DefaultClient).WithBaseURL(fake.URL),
+		batchSize:   100,
+		maxMessage:  1024,
+		maxInFlight: 4,
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.serve(ctx, listener)
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	fmt.Fprintln(conn, `{"jsonrpc": "2.0", "id": 1, "method": "ontologies"}`)
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"jsonrpc": "2.0", "id": 1, "result": {"ontologies": ["Hotels", "Restaurants", "Gadgets"]}}`, line)
+
+	cancel()
+	assert.Nil(t, <-done)
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/amccarthy1/intellexer"
+	"github.com/pkg/errors"
+)
+
+func setupServer(fs *flag.FlagSet) runFunc {
+	listen := fs.String("listen", "localhost:8080", "address to listen on")
+	quota := fs.Int("quota", 60, "requests per minute allowed for each caller (0 for no limit)")
+	callerHeader := fs.String("caller-header", "", "trust this header to identify callers for quotas, e.g. when behind an authenticating proxy that sets it (default: the client address)")
+	maxBody := fs.Int64("max-body", 1<<20, "maximum size of a request body in bytes")
+	maxReviews := fs.Int("max-reviews", 100, "maximum number of reviews in one sentiment request")
+	readTimeout := fs.Duration("read-timeout", 30*time.Second, "maximum time to read a request, including its body")
+	drainDelay := fs.Duration("drain-delay", 5*time.Second, "how long /readyz reports not ready before the server stops accepting connections")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 10*time.Second, "how long to wait for requests in flight when shutting down")
+	return func(env *environment, args []string) error {
+		if len(args) != 0 {
+			return usageError{"server takes no arguments"}
+		}
+		listener, err := net.Listen("tcp", *listen)
+		if err != nil {
+			return err
+		}
+		g := &gateway{
+			client:          env.client,
+			callerHeader:    *callerHeader,
+			maxBody:         *maxBody,
+			maxReviews:      *maxReviews,
+			quotas:          newQuotas(*quota, time.Now),
+			readTimeout:     *readTimeout,
+			drainDelay:      *drainDelay,
+			shutdownTimeout: *shutdownTimeout,
+			log:             env.stderr,
+		}
+		fmt.Fprintf(env.stderr, "listening on http://%s\n", listener.Addr())
+		return g.serve(env.ctx, listener)
+	}
+}
+
+// gateway exposes the client as a JSON HTTP API, so services that can't use
+// the Go client share its API key and configuration:
+//
+//	POST /v1/topics      {"text": "..."} or {"url": "..."}, returns the topics
+//	GET  /v1/ontologies  returns the ontologies
+//	POST /v1/sentiment   {"ontology": "hotels", "reviews": [{"id": "1", "text": "..."}]},
+//	                     returns the SentimentResponse
+//	GET  /healthz        200 while the process is up
+//	GET  /readyz         200 while it accepts requests, 503 once it is shutting down
+//
+// Errors are returned as {"error": "..."}. Quotas are per client address,
+// unless callerHeader is set, since callers could otherwise pick a new identity
+// for every request.
+type gateway struct {
+	client          *intellexer.Client
+	callerHeader    string
+	maxBody         int64
+	maxReviews      int
+	quotas          *quotas
+	readTimeout     time.Duration
+	drainDelay      time.Duration
+	shutdownTimeout time.Duration
+	log             io.Writer
+	logMu           sync.Mutex
+	draining        int32
+}
+
+// readHeaderTimeout is how long clients get to send the request headers.
+const readHeaderTimeout = 10 * time.Second
+
+func (g *gateway) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", g.healthz)
+	mux.HandleFunc("/readyz", g.readyz)
+	mux.Handle("/v1/topics", g.api("POST", g.topics))
+	mux.Handle("/v1/ontologies", g.api("GET", g.ontologies))
+	mux.Handle("/v1/sentiment", g.api("POST", g.sentiment))
+	return mux
+}
+
+// serve serves requests until ctx is done. It then reports not ready for
+// drainDelay, so load balancers stop sending traffic, before it stops
+// accepting connections and waits up to shutdownTimeout for the requests in
+// flight.
+func (g *gateway) serve(ctx context.Context, listener net.Listener) error {
+	server := &http.Server{
+		Handler:           g.handler(),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       g.readTimeout,
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+	atomic.StoreInt32(&g.draining, 1)
+	fmt.Fprintln(g.log, "draining")
+	time.Sleep(g.drainDelay)
+	fmt.Fprintln(g.log, "shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), g.shutdownTimeout)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+// httpError is an error with the status code to respond with.
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (err httpError) Error() string {
+	return err.msg
+}
+
+type apiFunc func(r *http.Request) (interface{}, error)
+
+// api wraps an endpoint with method checking, quotas, error handling and
+// logging.
+func (g *gateway) api(method string, fn apiFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		caller := g.caller(r)
+		status, body := g.call(w, r, method, caller, fn)
+		writeJSON(w, status, body)
+		g.logMu.Lock()
+		fmt.Fprintf(g.log, "%s %s %s %d %s\n", caller, r.Method, r.URL.Path, status, time.Since(start).Round(time.Millisecond))
+		g.logMu.Unlock()
+	})
+}
+
+func (g *gateway) call(w http.ResponseWriter, r *http.Request, method, caller string, fn apiFunc) (int, interface{}) {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		return http.StatusMethodNotAllowed, errorBody(fmt.Sprintf("use %s", method))
+	}
+	if wait, ok := g.quotas.take(caller); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return http.StatusTooManyRequests, errorBody("quota exceeded")
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, g.maxBody)
+	res, err := fn(r)
+	if err == nil {
+		return http.StatusOK, res
+	}
+	status, msg := errorStatus(err)
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "30")
+	}
+	return status, errorBody(msg)
+}
+
+// errorStatus maps an error to the status code to respond with. Upstream
+// failures are reported as gateway errors, since callers can't fix them.
+func errorStatus(err error) (int, string) {
+	switch cause := errors.Cause(err).(type) {
+	case httpError:
+		return cause.status, cause.msg
+	case validationError:
+		return http.StatusBadRequest, cause.Error()
+	case intellexer.ReviewIDError:
+		return http.StatusBadRequest, cause.Error()
+	case intellexer.DocumentTooLargeError:
+		return http.StatusRequestEntityTooLarge, cause.Error()
+	case intellexer.BreakerOpenError:
+		return http.StatusServiceUnavailable, cause.Error()
+	case intellexer.APIError:
+		if cause.Response.StatusCode == http.StatusTooManyRequests {
+			return http.StatusServiceUnavailable, "upstream quota exceeded"
+		}
+		return http.StatusBadGateway, cause.Error()
+	}
+	return http.StatusBadGateway, err.Error()
+}
+
+func errorBody(msg string) interface{} {
+	return map[string]string{"error": msg}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	newEncoder(w).Encode(body)
+}
+
+// caller identifies the caller of a request for quotas.
+func (g *gateway) caller(r *http.Request) string {
+	if len(g.callerHeader) > 0 {
+		if caller := r.Header.Get(g.callerHeader); len(caller) > 0 {
+			return caller
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (g *gateway) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (g *gateway) readyz(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&g.draining) == 1 {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "shutting down"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// decodeBody decodes a JSON request body, rejecting unknown fields so typos
+// don't go unnoticed.
+func decodeBody(r *http.Request, out interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(out); err != nil {
+		if strings.Contains(err.Error(), "request body too large") {
+			return httpError{http.StatusRequestEntityTooLarge, "request body too large"}
+		}
+		return validationError(fmt.Sprintf("invalid JSON body: %v", err))
+	}
+	return nil
+}
+
+func (g *gateway) topics(r *http.Request) (interface{}, error) {
+	var req topicsRequest
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	topics, err := req.run(r.Context(), g.client)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]string{"topics": topics}, nil
+}
+
+func (g *gateway) ontologies(r *http.Request) (interface{}, error) {
+	ontologies, err := g.client.ListOntologies()
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]intellexer.Ontology{"ontologies": ontologies}, nil
+}
+
+func (g *gateway) sentiment(r *http.Request) (interface{}, error) {
+	var req sentimentRequest
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	ontology, err := req.validate(g.maxReviews)
+	if err != nil {
+		return nil, err
+	}
+	return g.client.AnalyzeSentiments(ontology, req.Reviews)
+}
+
+// quotas is a token bucket per caller, refilling at limit tokens per minute up
+// to limit.
+type quotas struct {
+	limit   int
+	now     func() time.Time
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// maxBuckets is the number of callers tracked before the buckets of callers
+// with a full quota are dropped, since they are the same as new ones.
+const maxBuckets = 10000
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newQuotas(limit int, now func() time.Time) *quotas {
+	return &quotas{limit: limit, now: now, buckets: make(map[string]*bucket)}
+}
+
+// take takes a token for the caller. If there is none left, it returns how
+// long until there is.
+func (q *quotas) take(caller string) (time.Duration, bool) {
+	if q.limit <= 0 {
+		return 0, true
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := q.now()
+	rate := float64(q.limit) / float64(time.Minute)
+	if len(q.buckets) >= maxBuckets {
+		q.prune(now)
+	}
+	b, ok := q.buckets[caller]
+	if !ok {
+		b = &bucket{tokens: float64(q.limit), last: now}
+		q.buckets[caller] = b
+	}
+	b.tokens = math.Min(float64(q.limit), b.tokens+float64(now.Sub(b.last))*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / rate), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+func (q *quotas) prune(now time.Time) {
+	rate := float64(q.limit) / float64(time.Minute)
+	for caller, b := range q.buckets {
+		if b.tokens+float64(now.Sub(b.last))*rate >= float64(q.limit) {
+			delete(q.buckets, caller)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amccarthy1/intellexer"
+	"github.com/amccarthy1/intellexer/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestGateway(apiKey string, quota int) (*gateway, func()) {
+	fake := mocks.NewFakeServer("secret")
+	g := &gateway{
+		client:          intellexer.NewClient(apiKey).WithHTTPClient(http.DefaultClient).WithBaseURL(fake.URL),
+		maxBody:         1024,
+		maxReviews:      2,
+		quotas:          newQuotas(quota, time.Now),
+		readTimeout:     time.Second,
+		shutdownTimeout: time.Second,
+		log:             ioutil.Discard,
+	}
+	return g, fake.Close
+}
+
+func call(t *testing.T, h http.Handler, method, path, body string) (int, map[string]interface{}) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var out map[string]interface{}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &out), rec.Body.String())
+	return rec.Code, out
+}
+
+func TestGateway(t *testing.T) {
+	g, stop := newTestGateway("secret", 0)
+	defer stop()
+	h := g.handler()
+
+	status, body := call(t, h, "POST", "/v1/topics", `{"text": "football and health"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []interface{}{"Health.healthcare", "Sports.football"}, body["topics"])
+
+	status, body = call(t, h, "GET", "/v1/ontologies", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []interface{}{"Hotels", "Restaurants", "Gadgets"}, body["ontologies"])
+
+	status, body = call(t, h, "POST", "/v1/sentiment", `{"ontology": "Hotels", "reviews": [{"id": "a", "text": "I love it"}]}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "hotels", body["ontology"])
+
+	status, _ = call(t, h, "GET", "/healthz", "")
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = call(t, h, "GET", "/readyz", "")
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestGatewayValidation(t *testing.T) {
+	g, stop := newTestGateway("secret", 0)
+	defer stop()
+	h := g.handler()
+
+	for _, test := range []struct {
+		method, path, body string
+		status             int
+		err                string
+	}{
+		{"GET", "/v1/topics", "", http.StatusMethodNotAllowed, "use POST"},
+		{"POST", "/v1/topics", `{}`, http.StatusBadRequest, "text or url is required"},
+		{"POST", "/v1/topics", `{"txt": "typo"}`, http.StatusBadRequest, "unknown field"},
+		{"POST", "/v1/topics", `{"text": "` + strings.Repeat("a", 2000) + `"}`, http.StatusRequestEntityTooLarge, "too large"},
+		{"POST", "/v1/sentiment", `{"ontology": "cars", "reviews": [{"id": "a", "text": "x"}]}`, http.StatusBadRequest, "unknown ontology"},
+		{"POST", "/v1/sentiment", `{"ontology": "hotels"}`, http.StatusBadRequest, "at least one review"},
+		{"POST", "/v1/sentiment", `{"ontology": "hotels", "reviews": [{"id": "a", "text": "x"}, {"id": "a", "text": "y"}]}`,
+			http.StatusBadRequest, "duplicate ID"},
+		{"POST", "/v1/sentiment", `{"ontology": "hotels", "reviews": [{"id": "a", "text": " "}]}`, http.StatusBadRequest, "no text"},
+		{"POST", "/v1/sentiment", `{"ontology": "hotels", "reviews": [{}, {}, {}]}`, http.StatusBadRequest, "at most 2"},
+	} {
+		status, body := call(t, h, test.method, test.path, test.body)
+		assert.Equal(t, test.status, status, test.body)
+		assert.Contains(t, body["error"], test.err)
+	}
+
+	// Upstream errors don't leak the key
+	g, stop = newTestGateway("wrong", 0)
+	defer stop()
+	status, body := call(t, g.handler(), "GET", "/v1/ontologies", "")
+	assert.Equal(t, http.StatusBadGateway, status)
+	assert.Contains(t, body["error"], "401")
+	assert.NotContains(t, body["error"], "wrong")
+}
+
+func TestQuotas(t *testing.T) {
+	now := time.Unix(0, 0)
+	q := newQuotas(2, func() time.Time { return now })
+	_, ok := q.take("a")
+	assert.True(t, ok)
+	_, ok = q.take("a")
+	assert.True(t, ok)
+	wait, ok := q.take("a")
+	assert.False(t, ok)
+	assert.Equal(t, 30*time.Second, wait)
+	_, ok = q.take("b")
+	assert.True(t, ok)
+	now = now.Add(30 * time.Second)
+	_, ok = q.take("a")
+	assert.True(t, ok)
+
+	g, stop := newTestGateway("secret", 1)
+	defer stop()
+	h := g.handler()
+	get := func(remoteAddr, callerID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/v1/ontologies", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Caller-ID", callerID)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	assert.Equal(t, http.StatusOK, get("192.0.2.1:1234", "a").Code)
+	// The header isn't trusted unless enabled, so it can't dodge the quota
+	rec := get("192.0.2.1:5678", "b")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, get("192.0.2.2:1234", "a").Code)
+
+	g.callerHeader = "X-Caller-ID"
+	assert.Equal(t, http.StatusOK, get("192.0.2.3:1234", "c").Code)
+	assert.Equal(t, http.StatusOK, get("192.0.2.3:1234", "d").Code)
+	assert.Equal(t, http.StatusTooManyRequests, get("192.0.2.4:1234", "c").Code)
+}
+
+func TestGatewayShutdown(t *testing.T) {
+	g, stop := newTestGateway("secret", 0)
+	defer stop()
+	g.drainDelay = 200 * time.Millisecond
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	base := "http://" + listener.Addr().String()
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- g.serve(ctx, listener)
+	}()
+
+	res, err := client.Post(base+"/v1/topics", "application/json", bytes.NewReader([]byte(`{"text": "tech"}`)))
+	assert.Nil(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	res, err = client.Get(base + "/readyz")
+	assert.Nil(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// While draining, the server still answers but reports not ready
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	res, err = client.Get(base + "/readyz")
+	if assert.Nil(t, err) {
+		res.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	}
+	select {
+	case <-done:
+		t.Fatal("serve returned before the drain delay")
+	default:
+	}
+
+	assert.Nil(t, <-done)
+	_, err = client.Get(base + "/healthz")
+	assert.NotNil(t, err)
+}
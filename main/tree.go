@@ -0,0 +1,207 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/amccarthy1/intellexer"
+	"github.com/google/uuid"
+)
+
+// treeExports are the formats the opinion tree can be exported as, in addition
+// to the regular output formats.
+var treeExports = []string{"dot", "mermaid"}
+
+func isValidExport(export string) bool {
+	for _, e := range treeExports {
+		if e == export {
+			return true
+		}
+	}
+	return false
+}
+
+func setupOpinionTree(fs *flag.FlagSet) runFunc {
+	ontology := fs.String("ontology", string(intellexer.Gadgets), "ontology to analyze the reviews in (hotels, restaurants, gadgets)")
+	export := fs.String("export", "", "export the tree as a graph ("+strings.Join(treeExports, ", ")+") instead of using --format")
+	noColor := fs.Bool("no-color", false, "disable colored output (it is only used on terminals anyway)")
+	return func(env *environment, args []string) error {
+		if len(args) == 0 {
+			return usageError{"at least one review is required"}
+		}
+		// Check the export format before paying for the request
+		if len(*export) > 0 && !isValidExport(*export) {
+			return usageError{fmt.Sprintf("unknown export format %q", *export)}
+		}
+		reviews := make([]intellexer.Review, len(args))
+		for i, text := range args {
+			reviews[i] = intellexer.Review{ID: uuid.New().String(), Text: text}
+		}
+		res, err := env.client.AnalyzeSentiments(intellexer.Ontology(*ontology), reviews)
+		if err != nil {
+			return err
+		}
+		switch *export {
+		case "dot":
+			return writeDOT(env.stdout, res.Opinions)
+		case "mermaid":
+			return writeMermaid(env.stdout, res.Opinions)
+		}
+		color := !*noColor && isTerminal(env.stdout)
+		return opinionResults(res.Opinions, color).write(env.stdout, env.format)
+	}
+}
+
+// opinionText returns the text of an opinion, which the API sometimes leaves
+// out.
+func opinionText(node intellexer.Opinion) string {
+	if node.Text == nil {
+		return "(none)"
+	}
+	return *node.Text
+}
+
+// signedWeight formats a weight with an explicit sign for positive values.
+func signedWeight(weight float64) string {
+	if weight > 0 {
+		return "+" + formatWeight(weight)
+	}
+	return formatWeight(weight)
+}
+
+type opinionResult struct {
+	Path   []string `json:"path"`
+	Weight float64  `json:"weight"`
+}
+
+// walkOpinions calls fn for every node below root, depth first, with the path of
+// texts leading to it. The root itself is the unnamed top of the tree and is
+// skipped.
+func walkOpinions(root intellexer.Opinion, fn func(node intellexer.Opinion, path []string, last []bool)) {
+	var walk func(node intellexer.Opinion, path []string, last []bool)
+	walk = func(node intellexer.Opinion, path []string, last []bool) {
+		for i, child := range node.Children {
+			childPath := append(path[:len(path):len(path)], opinionText(child))
+			childLast := append(last[:len(last):len(last)], i == len(node.Children)-1)
+			fn(child, childPath, childLast)
+			walk(child, childPath, childLast)
+		}
+	}
+	walk(root, nil, nil)
+}
+
+// opinionResults flattens an opinion tree into one row per node. The text
+// format draws the tree itself.
+func opinionResults(root intellexer.Opinion, color bool) results {
+	r := results{
+		full:    root,
+		columns: []string{"path", "weight"},
+		text: func(w io.Writer) {
+			writeTree(w, root, color)
+		},
+	}
+	walkOpinions(root, func(node intellexer.Opinion, path []string, last []bool) {
+		r.rows = append(r.rows, []string{strings.Join(path, " > "), formatWeight(node.SentimentWeight)})
+		r.records = append(r.records, opinionResult{Path: path, Weight: node.SentimentWeight})
+	})
+	return r
+}
+
+// writeTree draws an opinion tree with box-drawing characters, coloring the
+// weights by polarity.
+func writeTree(w io.Writer, root intellexer.Opinion, color bool) {
+	walkOpinions(root, func(node intellexer.Opinion, path []string, last []bool) {
+		var prefix strings.Builder
+		for _, isLast := range last[:len(last)-1] {
+			if isLast {
+				prefix.WriteString("    ")
+			} else {
+				prefix.WriteString("│   ")
+			}
+		}
+		if last[len(last)-1] {
+			prefix.WriteString("└── ")
+		} else {
+			prefix.WriteString("├── ")
+		}
+		weight := signedWeight(node.SentimentWeight)
+		if color {
+			weight = colorWeight(node.SentimentWeight, weight)
+		}
+		fmt.Fprintf(w, "%s%s %s\n", prefix.String(), opinionText(node), weight)
+	})
+}
+
+// colorWeight wraps text in the color of the weight's polarity.
+func colorWeight(weight float64, text string) string {
+	switch {
+	case weight > 0:
+		return ansiGreen + text + ansiReset
+	case weight < 0:
+		return ansiRed + text + ansiReset
+	}
+	return ansiDim + text + ansiReset
+}
+
+// graphColor returns the fill color of a node in exported graphs.
+func graphColor(weight float64) string {
+	switch {
+	case weight > 0:
+		return "palegreen"
+	case weight < 0:
+		return "lightpink"
+	}
+	return "lightgrey"
+}
+
+// graphNodes calls fn for every node below root with an ID for the node and
+// its parent. Top-level nodes have an empty parent ID.
+func graphNodes(root intellexer.Opinion, fn func(id, parent string, node intellexer.Opinion)) {
+	var n int
+	var walk func(node intellexer.Opinion, parent string)
+	walk = func(node intellexer.Opinion, parent string) {
+		for _, child := range node.Children {
+			id := fmt.Sprintf("n%d", n)
+			n++
+			fn(id, parent, child)
+			walk(child, id)
+		}
+	}
+	walk(root, "")
+}
+
+// writeDOT exports an opinion tree as a Graphviz digraph.
+func writeDOT(w io.Writer, root intellexer.Opinion) error {
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	fmt.Fprintln(w, "digraph opinions {")
+	fmt.Fprintln(w, "  node [shape=box, style=filled];")
+	graphNodes(root, func(id, parent string, node intellexer.Opinion) {
+		label := escaper.Replace(opinionText(node)) + `\n` + signedWeight(node.SentimentWeight)
+		fmt.Fprintf(w, "  %s [label=\"%s\", fillcolor=%s];\n", id, label, graphColor(node.SentimentWeight))
+		if len(parent) > 0 {
+			fmt.Fprintf(w, "  %s -> %s;\n", parent, id)
+		}
+	})
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// writeMermaid exports an opinion tree as a Mermaid flowchart.
+func writeMermaid(w io.Writer, root intellexer.Opinion) error {
+	escaper := strings.NewReplacer(`"`, "#quot;")
+	fmt.Fprintln(w, "graph TD")
+	classes := map[string]string{"palegreen": "positive", "lightpink": "negative", "lightgrey": "neutral"}
+	graphNodes(root, func(id, parent string, node intellexer.Opinion) {
+		label := escaper.Replace(opinionText(node)) + " " + signedWeight(node.SentimentWeight)
+		fmt.Fprintf(w, "  %s[\"%s\"]:::%s\n", id, label, classes[graphColor(node.SentimentWeight)])
+		if len(parent) > 0 {
+			fmt.Fprintf(w, "  %s --> %s\n", parent, id)
+		}
+	})
+	for _, color := range []string{"palegreen", "lightpink", "lightgrey"} {
+		fmt.Fprintf(w, "  classDef %s fill:%s\n", classes[color], color)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/amccarthy1/intellexer"
+	"github.com/stretchr/testify/assert"
+)
+
+func text(s string) *string {
+	return &s
+}
+
+var treeOpinions = intellexer.Opinion{
+	Children: []intellexer.Opinion{
+		{Text: text("Room"), SentimentWeight: 1, Children: []intellexer.Opinion{
+			{Text: text("bed"), SentimentWeight: 2},
+			{Text: text(`"view"`), SentimentWeight: -1},
+		}},
+		{Text: text("Staff"), Children: []intellexer.Opinion{
+			{Text: text("reception")},
+		}},
+	},
+}
+
+func TestWriteTree(t *testing.T) {
+	var buf bytes.Buffer
+	writeTree(&buf, treeOpinions, false)
+	assert.Equal(t, `├── Room +1
+│   ├── bed +2
+│   └── "view" -1
+└── Staff 0
+    └── reception 0
+`, buf.String())
+
+	buf.Reset()
+	writeTree(&buf, treeOpinions, true)
+	assert.Contains(t, buf.String(), "bed "+ansiGreen+"+2"+ansiReset)
+	assert.Contains(t, buf.String(), `"view" `+ansiRed+"-1"+ansiReset)
+}
+
+func TestOpinionResults(t *testing.T) {
+	assert.Equal(t, "path,weight\nRoom,1\nRoom > bed,2\n\"Room > \"\"view\"\"\",-1\nStaff,0\nStaff > reception,0\n",
+		writeResults(t, opinionResults(treeOpinions, false), "csv"))
+	assert.Contains(t, writeResults(t, opinionResults(treeOpinions, false), "ndjson"),
+		`{"path":["Room","bed"],"weight":2}`)
+}
+
+func TestExportTree(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, writeDOT(&buf, treeOpinions))
+	dot := buf.String()
+	assert.Contains(t, dot, "digraph opinions {\n")
+	assert.Contains(t, dot, `  n2 [label="\"view\"\n-1", fillcolor=lightpink];`)
+	assert.Contains(t, dot, "  n0 -> n2;\n")
+	assert.Contains(t, dot, "  n3 -> n4;\n")
+
+	buf.Reset()
+	assert.Nil(t, writeMermaid(&buf, treeOpinions))
+	mermaid := buf.String()
+	assert.Contains(t, mermaid, "graph TD\n")
+	assert.Contains(t, mermaid, `  n1["bed +2"]:::positive`)
+	assert.Contains(t, mermaid, `  n2["#quot;view#quot; -1"]:::negative`)
+	assert.Contains(t, mermaid, "  n0 --> n1\n")
+	assert.Contains(t, mermaid, "  classDef neutral fill:lightgrey\n")
+}
+
+func TestOpinionTreeCommand(t *testing.T) {
+	code, stdout, stderr := runCLI(t, "opinion_tree", "--no-color", "I love it")
+	assert.Equal(t, exitOK, code, stderr)
+	assert.Contains(t, stdout, "└── ")
+
+	code, stdout, _ = runCLI(t, "opinion_tree", "--export", "mermaid", "I love it")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, "graph TD\n")
+
+	code, stdout, _ = runCLI(t, "opinion_tree", "I love it")
+	assert.Equal(t, exitOK, code)
+	assert.NotContains(t, stdout, "\x1b[")
+
+	// The export format is checked before any request is made, so an
+	// unreachable API doesn't matter
+	code, _, stderr = runCLIWithEnv(t, map[string]string{"API_KEY": "secret"}, "http://127.0.0.1:1", "",
+		"opinion_tree", "--export", "svg", "I love it")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, `unknown export format "svg"`)
+}
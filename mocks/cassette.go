@@ -0,0 +1,184 @@
+package mocks
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// redactedValue replaces secrets in recorded cassettes.
+const redactedValue = "REDACTED"
+
+// HTTPClient is the interface the intellexer client uses to send requests. It
+// is satisfied by *http.Client and by every mock in this package.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Mode is the mode a Recorder operates in.
+type Mode int
+
+const (
+	// Replay serves recorded responses and never touches the network.
+	Replay Mode = iota
+	// Record sends requests through the wrapped client and saves the responses.
+	Record
+)
+
+// Interaction is a recorded request/response pair, stored as one JSON file per
+// interaction.
+type Interaction struct {
+	Request struct {
+		Method string `json:"method"`
+		URL    string `json:"url"`
+		Body   string `json:"body"`
+	} `json:"request"`
+	Response struct {
+		StatusCode int         `json:"statusCode"`
+		Header     http.Header `json:"header"`
+		Body       string      `json:"body"`
+	} `json:"response"`
+}
+
+// Recorder is an HTTP client that records real API responses to cassette files
+// and replays them later, so tests can use real responses without network
+// access. Requests are matched by endpoint and by a hash of the request body
+// and query parameters, so the same request always maps to the same file. The
+// apiKey query parameter is redacted before anything is written or hashed.
+type Recorder struct {
+	mode   Mode
+	dir    string
+	client HTTPClient
+	mu     sync.Mutex
+}
+
+// NewRecorder returns a recorder storing cassettes in dir (usually somewhere
+// under testdata). In Record mode, requests are sent with client; in Replay
+// mode client is unused and may be nil.
+func NewRecorder(dir string, mode Mode, client HTTPClient) *Recorder {
+	return &Recorder{mode: mode, dir: dir, client: client}
+}
+
+// Do records or replays the request depending on the recorder's mode.
+func (r *Recorder) Do(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	redacted := redactURL(req.URL)
+	filename := filepath.Join(r.dir, cassetteName(req.Method, redacted, body))
+
+	if r.mode == Replay {
+		return r.replay(req, redacted, filename)
+	}
+	return r.record(req, redacted, body, filename)
+}
+
+func (r *Recorder) replay(req *http.Request, redacted *url.URL, filename string) (*http.Response, error) {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf(
+			"No recorded interaction for %s %s (expected %s), re-run in Record mode",
+			req.Method, redacted, filename,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var interaction Interaction
+	if err := json.Unmarshal(data, &interaction); err != nil {
+		return nil, fmt.Errorf("Corrupt cassette %s: %v", filename, err)
+	}
+	return &http.Response{
+		StatusCode: interaction.Response.StatusCode,
+		Header:     interaction.Response.Header,
+		Body:       ioutil.NopCloser(strings.NewReader(interaction.Response.Body)),
+		Request:    req,
+	}, nil
+}
+
+func (r *Recorder) record(req *http.Request, redacted *url.URL, body []byte, filename string) (*http.Response, error) {
+	res, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(resBody))
+
+	var interaction Interaction
+	interaction.Request.Method = req.Method
+	interaction.Request.URL = redacted.String()
+	interaction.Request.Body = string(body)
+	interaction.Response.StatusCode = res.StatusCode
+	interaction.Response.Header = res.Header
+	interaction.Response.Body = string(resBody)
+	data, err := json.MarshalIndent(interaction, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// redactURL returns a copy of u with the apiKey query parameter redacted.
+func redactURL(u *url.URL) *url.URL {
+	redacted := *u
+	query := u.Query()
+	if _, ok := query["apiKey"]; ok {
+		query.Set("apiKey", redactedValue)
+		redacted.RawQuery = query.Encode()
+	}
+	return &redacted
+}
+
+// cassetteName returns the file name for a request: the endpoint followed by a
+// hash of everything else that distinguishes the request.
+func cassetteName(method string, u *url.URL, body []byte) string {
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n", method)
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%s=%s\n", key, strings.Join(query[key], ","))
+	}
+	hash.Write(body)
+	endpoint := path.Base(u.Path)
+	if endpoint == "." || endpoint == "/" {
+		endpoint = "root"
+	}
+	return fmt.Sprintf("%s-%s.json", endpoint, hex.EncodeToString(hash.Sum(nil))[:16])
+}
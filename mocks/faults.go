@@ -0,0 +1,266 @@
+package mocks
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Fault is a kind of failure a FaultInjector can inject.
+type Fault int
+
+const (
+	// NoFault passes the request through untouched.
+	NoFault Fault = iota
+	// Delay waits for the configured latency before passing the request
+	// through. The wait is cut short if the request's context is cancelled.
+	Delay
+	// Timeout waits for the configured latency and then fails with a timeout
+	// error, without sending the request.
+	Timeout
+	// ConnectionReset fails with a connection reset error, without sending the
+	// request.
+	ConnectionReset
+	// PartialBody passes the request through but truncates the response body
+	// halfway, so reading it fails with io.ErrUnexpectedEOF.
+	PartialBody
+	// RateLimited responds with a 429 and a Retry-After header, without sending
+	// the request.
+	RateLimited
+	// HTMLErrorPage responds with a 200 whose body is an HTML error page, like
+	// the API does for some malformed requests, without sending the request.
+	HTMLErrorPage
+)
+
+func (f Fault) String() string {
+	switch f {
+	case NoFault:
+		return "none"
+	case Delay:
+		return "delay"
+	case Timeout:
+		return "timeout"
+	case ConnectionReset:
+		return "connection reset"
+	case PartialBody:
+		return "partial body"
+	case RateLimited:
+		return "rate limited"
+	case HTMLErrorPage:
+		return "html error page"
+	}
+	return "unknown"
+}
+
+// defaultHTMLErrorPage is an abbreviated version of the error page the API
+// returns, see testdata/content_type_error.xhtml.
+const defaultHTMLErrorPage = `<?xml version="1.0" encoding="utf-8"?>
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml">
+    <head><title>Request Error</title></head>
+    <body><div id="content"><p class="heading1">Request Error</p></div></body>
+</html>`
+
+// timeoutError mimics the errors net/http returns on timeouts.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "mocks: injected timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+type probableFault struct {
+	fault       Fault
+	probability float64
+}
+
+// FaultInjector wraps an HTTP client and injects failures into its requests.
+// Faults are chosen deterministically from a sequence first, then
+// probabilistically from the configured probabilities, and requests that get
+// no fault pass straight through to the wrapped client.
+type FaultInjector struct {
+	client     HTTPClient
+	latency    time.Duration
+	retryAfter time.Duration
+	htmlPage   []byte
+
+	mu       sync.Mutex
+	rand     *rand.Rand
+	sequence []Fault
+	probable []probableFault
+	injected map[Fault]int
+}
+
+// NewFaultInjector returns a fault injector wrapping client that injects no
+// faults until configured to.
+func NewFaultInjector(client HTTPClient) *FaultInjector {
+	return &FaultInjector{
+		client:     client,
+		latency:    100 * time.Millisecond,
+		retryAfter: time.Second,
+		htmlPage:   []byte(defaultHTMLErrorPage),
+		rand:       rand.New(rand.NewSource(1)),
+		injected:   make(map[Fault]int),
+	}
+}
+
+// WithSequence queues faults to inject, one per request, in order. Use NoFault
+// to let a request through. Once the sequence is used up, faults are chosen
+// probabilistically.
+func (fi *FaultInjector) WithSequence(faults ...Fault) *FaultInjector {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.sequence = append(fi.sequence, faults...)
+	return fi
+}
+
+// WithProbability injects fault into each request with the given probability
+// (between 0 and 1). Probabilities are checked in the order they were added,
+// and the first fault whose roll succeeds is injected.
+func (fi *FaultInjector) WithProbability(fault Fault, probability float64) *FaultInjector {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.probable = append(fi.probable, probableFault{fault, probability})
+	return fi
+}
+
+// WithSeed seeds the random source used for probabilistic faults, so runs are
+// reproducible. The default seed is 1.
+func (fi *FaultInjector) WithSeed(seed int64) *FaultInjector {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.rand = rand.New(rand.NewSource(seed))
+	return fi
+}
+
+// WithLatency sets how long Delay and Timeout faults wait. Default 100ms.
+func (fi *FaultInjector) WithLatency(latency time.Duration) *FaultInjector {
+	fi.latency = latency
+	return fi
+}
+
+// WithRetryAfter sets the Retry-After header sent with RateLimited faults,
+// rounded to whole seconds. Default 1s.
+func (fi *FaultInjector) WithRetryAfter(retryAfter time.Duration) *FaultInjector {
+	fi.retryAfter = retryAfter
+	return fi
+}
+
+// WithHTMLPage sets the body sent with HTMLErrorPage faults, for instance the
+// contents of testdata/content_type_error.xhtml.
+func (fi *FaultInjector) WithHTMLPage(page []byte) *FaultInjector {
+	fi.htmlPage = page
+	return fi
+}
+
+// Injected returns how many times each fault has been injected.
+func (fi *FaultInjector) Injected() map[Fault]int {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	injected := make(map[Fault]int, len(fi.injected))
+	for fault, count := range fi.injected {
+		injected[fault] = count
+	}
+	return injected
+}
+
+func (fi *FaultInjector) nextFault() Fault {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fault := NoFault
+	if len(fi.sequence) > 0 {
+		fault, fi.sequence = fi.sequence[0], fi.sequence[1:]
+	} else {
+		for _, p := range fi.probable {
+			if fi.rand.Float64() < p.probability {
+				fault = p.fault
+				break
+			}
+		}
+	}
+	if fault != NoFault {
+		fi.injected[fault]++
+	}
+	return fault
+}
+
+// Do sends the request through the wrapped client, injecting a fault if one
+// is chosen.
+func (fi *FaultInjector) Do(req *http.Request) (*http.Response, error) {
+	switch fi.nextFault() {
+	case Delay:
+		if err := fi.wait(req); err != nil {
+			return nil, err
+		}
+	case Timeout:
+		if err := fi.wait(req); err != nil {
+			return nil, err
+		}
+		return nil, timeoutError{}
+	case ConnectionReset:
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	case PartialBody:
+		res, err := fi.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		return truncateBody(res)
+	case RateLimited:
+		header := make(http.Header)
+		header.Set("Retry-After", strconv.Itoa(int(fi.retryAfter/time.Second)))
+		return fi.respond(req, http.StatusTooManyRequests, header, []byte("Too Many Requests")), nil
+	case HTMLErrorPage:
+		header := make(http.Header)
+		header.Set("Content-Type", "text/html; charset=utf-8")
+		return fi.respond(req, http.StatusOK, header, fi.htmlPage), nil
+	}
+	return fi.client.Do(req)
+}
+
+func (fi *FaultInjector) wait(req *http.Request) error {
+	timer := time.NewTimer(fi.latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+func (fi *FaultInjector) respond(req *http.Request, statusCode int, header http.Header, body []byte) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}
+}
+
+func truncateBody(res *http.Response) (*http.Response, error) {
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(io.MultiReader(
+		bytes.NewReader(body[:len(body)/2]),
+		errReader{io.ErrUnexpectedEOF},
+	))
+	return res, nil
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,243 @@
+package mocks
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// RecordedRequest is a request received by a ScriptedClient.
+type RecordedRequest struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+	Body   []byte
+}
+
+// AssertJSONBody asserts that the request body is JSON equivalent to expected.
+func (r RecordedRequest) AssertJSONBody(t assert.TestingT, expected string) bool {
+	return assert.JSONEq(t, expected, string(r.Body))
+}
+
+// AssertQuery asserts that the request has the given query parameter.
+func (r RecordedRequest) AssertQuery(t assert.TestingT, key, value string) bool {
+	return assert.Equal(t, value, r.URL.Query().Get(key), "query parameter %q", key)
+}
+
+type scriptedResponse struct {
+	statusCode int
+	body       []byte
+	header     http.Header
+	err        error
+}
+
+// Rule matches requests to a ScriptedClient and holds the responses to give
+// them. Create rules with ScriptedClient.On.
+type Rule struct {
+	method    string
+	path      string
+	query     url.Values
+	responses []scriptedResponse
+	calls     int
+}
+
+// WithQuery restricts the rule to requests that have the given query
+// parameter, e.g. WithQuery("ontology", "hotels").
+func (r *Rule) WithQuery(key, value string) *Rule {
+	r.query.Add(key, value)
+	return r
+}
+
+// Respond queues a response with the given status code and body.
+func (r *Rule) Respond(statusCode int, body string) *Rule {
+	r.responses = append(r.responses, scriptedResponse{statusCode: statusCode, body: []byte(body)})
+	return r
+}
+
+// RespondWithHeader queues a response with the given status code, headers and
+// body.
+func (r *Rule) RespondWithHeader(statusCode int, header http.Header, body string) *Rule {
+	r.responses = append(r.responses, scriptedResponse{
+		statusCode: statusCode,
+		header:     header,
+		body:       []byte(body),
+	})
+	return r
+}
+
+// RespondWithFile queues a response with the contents of a file as the body.
+func (r *Rule) RespondWithFile(statusCode int, filename string) *Rule {
+	body, err := ioutil.ReadFile(filename)
+	if err != nil {
+		panic(err)
+	}
+	r.responses = append(r.responses, scriptedResponse{statusCode: statusCode, body: body})
+	return r
+}
+
+// Fail queues an error, as if the request could not be sent.
+func (r *Rule) Fail(err error) *Rule {
+	r.responses = append(r.responses, scriptedResponse{err: err})
+	return r
+}
+
+func (r *Rule) matches(req *http.Request) bool {
+	if r.method != req.Method {
+		return false
+	}
+	path := "/" + strings.TrimPrefix(r.path, "/")
+	if req.URL.Path != strings.TrimPrefix(path, "/") && !strings.HasSuffix(req.URL.Path, path) {
+		return false
+	}
+	query := req.URL.Query()
+	for key, values := range r.query {
+		for _, value := range values {
+			if !containsString(query[key], value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// next returns the next queued response. Once the queue is exhausted, the last
+// response is repeated.
+func (r *Rule) next() scriptedResponse {
+	i := r.calls
+	if i >= len(r.responses) {
+		i = len(r.responses) - 1
+	}
+	r.calls++
+	return r.responses[i]
+}
+
+// ScriptedClient is a fake HTTP client that matches requests against rules
+// and responds with the responses queued on the first matching rule, in order.
+// Every request it receives is recorded, so tests can make assertions about
+// what was sent. Requests that match no rule fail with an error.
+type ScriptedClient struct {
+	mu       sync.Mutex
+	rules    []*Rule
+	requests []RecordedRequest
+}
+
+// NewScriptedClient returns a scripted client with no rules.
+func NewScriptedClient() *ScriptedClient {
+	return &ScriptedClient{}
+}
+
+// On adds a rule matching requests with the given method and path. The path is
+// matched against the end of the request path, so it doesn't matter which base
+// URL the client under test uses. Rules are checked in the order they were
+// added.
+func (sc *ScriptedClient) On(method, path string) *Rule {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	rule := &Rule{method: method, path: path, query: make(url.Values)}
+	sc.rules = append(sc.rules, rule)
+	return rule
+}
+
+// Do records the request and responds as scripted.
+func (sc *ScriptedClient) Do(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.requests = append(sc.requests, RecordedRequest{
+		Method: req.Method,
+		URL:    req.URL,
+		Header: req.Header,
+		Body:   body,
+	})
+	for _, rule := range sc.rules {
+		if !rule.matches(req) || len(rule.responses) == 0 {
+			continue
+		}
+		res := rule.next()
+		if res.err != nil {
+			return nil, res.err
+		}
+		header := res.header
+		if header == nil {
+			header = make(http.Header)
+		}
+		return &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewReader(res.body)),
+			StatusCode: res.statusCode,
+			Header:     header,
+			Request:    req,
+		}, nil
+	}
+	return nil, fmt.Errorf("No scripted response for %s %s", req.Method, req.URL)
+}
+
+// Requests returns every request received so far.
+func (sc *ScriptedClient) Requests() []RecordedRequest {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	requests := make([]RecordedRequest, len(sc.requests))
+	copy(requests, sc.requests)
+	return requests
+}
+
+// RequestsTo returns the requests received so far with the given method and
+// path, matched the same way as rules.
+func (sc *ScriptedClient) RequestsTo(method, path string) []RecordedRequest {
+	rule := &Rule{method: method, path: path}
+	var matched []RecordedRequest
+	for _, req := range sc.Requests() {
+		if rule.matches(&http.Request{Method: req.Method, URL: req.URL}) {
+			matched = append(matched, req)
+		}
+	}
+	return matched
+}
+
+// AssertCallCount asserts that exactly n requests were made with the given
+// method and path.
+func (sc *ScriptedClient) AssertCallCount(t assert.TestingT, method, path string, n int) bool {
+	return assert.Len(t, sc.RequestsTo(method, path), n, "requests to %s %s", method, path)
+}
+
+// AssertAllConsumed asserts that every queued response has been returned at
+// least once.
+func (sc *ScriptedClient) AssertAllConsumed(t assert.TestingT) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	ok := true
+	for _, rule := range sc.rules {
+		if rule.calls < len(rule.responses) {
+			ok = assert.Fail(
+				t,
+				"Unconsumed scripted responses",
+				"%s %s has %d of %d responses left",
+				rule.method, rule.path, len(rule.responses)-rule.calls, len(rule.responses),
+			) && ok
+		}
+	}
+	return ok
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,235 @@
+package mocks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+)
+
+// fakeOntologies are the ontologies served by the fake server, capitalized the
+// same way the real API capitalizes them.
+var fakeOntologies = []string{"Hotels", "Restaurants", "Gadgets"}
+
+// fakeTopicKeywords maps keywords to the topics the fake server reports for
+// any text containing them.
+var fakeTopicKeywords = map[string]string{
+	"health":   "Health.healthcare",
+	"doctor":   "Health.healthcare",
+	"tech":     "Tech.information_technology",
+	"software": "Tech.information_technology",
+	"football": "Sports.football",
+	"election": "Politics.elections",
+	"recipe":   "Food.cooking",
+}
+
+// fakeSentimentWords are the words the fake server scores, and their weights.
+var fakeSentimentWords = map[string]float64{
+	"love":     3,
+	"great":    2,
+	"good":     1,
+	"neat":     1,
+	"bad":      -1,
+	"poor":     -2,
+	"hate":     -3,
+	"terrible": -3,
+}
+
+// FakeServer is an in-process fake of the intellexer API, useful for
+// integration testing the client against real HTTP requests. Point a client at
+// it with WithBaseURL(server.URL). Responses are computed with simple,
+// deterministic keyword matching:
+//   - topics are looked up from a small fixed keyword list
+//   - a review's sentiment weight is the sum of the weights of the sentiment
+//     words it contains, and each sentiment word becomes an opinion
+//
+// The key is accepted either as the apiKey query parameter or in the
+// AuthHeader header, for clients using WithHeaderAuth. Requests without the
+// right key get a 401, and sentiment requests with a missing or unknown
+// ontology get a 400.
+type FakeServer struct {
+	*httptest.Server
+	// APIKey is the only API key the server accepts.
+	APIKey string
+	// AuthHeader is the header the key may be sent in. Default X-API-Key.
+	AuthHeader string
+}
+
+// NewFakeServer starts a fake server that accepts the given API key. Callers
+// should Close it when done.
+func NewFakeServer(apiKey string) *FakeServer {
+	fs := &FakeServer{APIKey: apiKey, AuthHeader: "X-API-Key"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/getTopicsFromUrl", fs.authorized("GET", fs.getTopicsFromURL))
+	mux.HandleFunc("/getTopicsFromFile", fs.authorized("POST", fs.getTopicsFromFile))
+	mux.HandleFunc("/sentimentAnalyzerOntologies", fs.authorized("GET", fs.listOntologies))
+	mux.HandleFunc("/analyzeSentiments", fs.authorized("POST", fs.analyzeSentiments))
+	fs.Server = httptest.NewServer(mux)
+	return fs
+}
+
+// WithAuthHeader sets the header the key may be sent in.
+func (fs *FakeServer) WithAuthHeader(header string) *FakeServer {
+	fs.AuthHeader = header
+	return fs
+}
+
+func (fs *FakeServer) authorized(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.URL.Query().Get("apiKey") != fs.APIKey && r.Header.Get(fs.AuthHeader) != fs.APIKey {
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func (fs *FakeServer) getTopicsFromURL(w http.ResponseWriter, r *http.Request) {
+	url := r.URL.Query().Get("url")
+	if len(url) == 0 {
+		http.Error(w, "Missing url parameter", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, fakeTopics(url))
+}
+
+func (fs *FakeServer) getTopicsFromFile(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Error reading body", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, fakeTopics(string(body)))
+}
+
+func (fs *FakeServer) listOntologies(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, fakeOntologies)
+}
+
+type fakeReview struct {
+	ID     string  `json:"id"`
+	Text   string  `json:"text"`
+	Author *string `json:"author"`
+	Title  *string `json:"title"`
+	Dt     *string `json:"dt"`
+}
+
+type fakeOpinion struct {
+	Children []fakeOpinion `json:"children"`
+	F        int           `json:"f"`
+	RS       []int         `json:"rs"`
+	T        *string       `json:"t"`
+	W        float64       `json:"w"`
+}
+
+type fakeSentence struct {
+	SID  string  `json:"sid"`
+	Text string  `json:"text"`
+	W    float64 `json:"w"`
+}
+
+type fakeSentiment struct {
+	Author *string `json:"author"`
+	Dt     *string `json:"dt"`
+	ID     string  `json:"id"`
+	Title  *string `json:"title"`
+	W      float64 `json:"w"`
+}
+
+func (fs *FakeServer) analyzeSentiments(w http.ResponseWriter, r *http.Request) {
+	ontology := strings.ToLower(r.URL.Query().Get("ontology"))
+	valid := false
+	for _, o := range fakeOntologies {
+		if strings.ToLower(o) == ontology {
+			valid = true
+		}
+	}
+	if !valid {
+		http.Error(w, fmt.Sprintf("Unknown ontology %q", ontology), http.StatusBadRequest)
+		return
+	}
+	var reviews []fakeReview
+	if err := json.NewDecoder(r.Body).Decode(&reviews); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	sentiments := []fakeSentiment{}
+	sentences := []fakeSentence{}
+	root := fakeOpinion{Children: []fakeOpinion{}, RS: []int{}}
+	for i, review := range reviews {
+		sentiment := fakeSentiment{
+			Author: review.Author,
+			Dt:     review.Dt,
+			ID:     review.ID,
+			Title:  review.Title,
+		}
+		var annotated []string
+		for _, word := range strings.Fields(review.Text) {
+			weight, ok := fakeSentimentWords[normalizeWord(word)]
+			if !ok {
+				annotated = append(annotated, word)
+				continue
+			}
+			sentiment.W += weight
+			tag := "pos"
+			if weight < 0 {
+				tag = "neg"
+			}
+			annotated = append(annotated, fmt.Sprintf(`<%s w="%g">%s</%s>`, tag, weight, word, tag))
+			text := normalizeWord(word)
+			root.Children = append(root.Children, fakeOpinion{
+				Children: []fakeOpinion{},
+				F:        1,
+				RS:       []int{i + 1},
+				T:        &text,
+				W:        weight,
+			})
+		}
+		sentiments = append(sentiments, sentiment)
+		sentences = append(sentences, fakeSentence{
+			SID:  review.ID,
+			Text: strings.Join(annotated, " "),
+			W:    sentiment.W,
+		})
+	}
+	writeJSON(w, map[string]interface{}{
+		"sentimentsCount": len(sentiments),
+		"ontology":        ontology,
+		"sentences":       sentences,
+		"opinions":        root,
+		"sentiments":      sentiments,
+	})
+}
+
+func fakeTopics(text string) []string {
+	text = strings.ToLower(text)
+	found := make(map[string]struct{})
+	for keyword, topic := range fakeTopicKeywords {
+		if strings.Contains(text, keyword) {
+			found[topic] = struct{}{}
+		}
+	}
+	topics := []string{}
+	for topic := range found {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+func normalizeWord(word string) string {
+	return strings.ToLower(strings.Trim(word, ".,!?;:\"'()"))
+}
+
+func writeJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,123 @@
+package intellexer
+
+import (
+	"math"
+)
+
+// Polarity is a label describing how positive or negative a weight is.
+type Polarity int
+
+// These are the polarity labels a Classifier can assign, ordered from most
+// negative to most positive.
+const (
+	StronglyNegative Polarity = iota - 2
+	Negative
+	Neutral
+	Positive
+	StronglyPositive
+)
+
+func (p Polarity) String() string {
+	switch p {
+	case StronglyNegative:
+		return "strongly negative"
+	case Negative:
+		return "negative"
+	case Neutral:
+		return "neutral"
+	case Positive:
+		return "positive"
+	case StronglyPositive:
+		return "strongly positive"
+	}
+	return "unknown"
+}
+
+// Weighted is implemented by every part of a SentimentResponse that carries a
+// sentiment weight, i.e. Sentiment, Sentence and Opinion.
+type Weighted interface {
+	// Weight returns the raw, unbounded sentiment weight.
+	Weight() float64
+}
+
+// Weight returns the sentiment weight of the review.
+func (s Sentiment) Weight() float64 { return s.SentimentWeight }
+
+// Weight returns the sentiment weight of the sentence.
+func (s Sentence) Weight() float64 { return s.SentimentWeight }
+
+// Weight returns the sentiment weight of the opinion.
+func (o Opinion) Weight() float64 { return o.SentimentWeight }
+
+// Classifier maps raw sentiment weights to polarity labels and bounded scores.
+// The API only guarantees that weights above 0 are positive and weights below
+// 0 are negative, so the thresholds are a matter of taste; DefaultClassifier
+// has values that work reasonably well for the three built-in ontologies. The
+// zero Classifier behaves like DefaultClassifier.
+type Classifier struct {
+	// Weights within [NeutralLow, NeutralHigh] are Neutral.
+	NeutralLow  float64
+	NeutralHigh float64
+	// Weights at or below StrongNegative are StronglyNegative, and weights at or
+	// above StrongPositive are StronglyPositive.
+	StrongNegative float64
+	StrongPositive float64
+	// Scale controls how quickly normalized scores approach their bounds. A
+	// weight of Scale normalizes to roughly 0.76. Must be positive.
+	Scale float64
+}
+
+// DefaultClassifier is a classifier with symmetric thresholds around 0.
+var DefaultClassifier = Classifier{
+	NeutralLow:     -0.5,
+	NeutralHigh:    0.5,
+	StrongNegative: -2,
+	StrongPositive: 2,
+	Scale:          2,
+}
+
+// Classify returns the polarity label of a raw weight.
+func (c Classifier) Classify(weight float64) Polarity {
+	if c == (Classifier{}) {
+		c = DefaultClassifier
+	}
+	switch {
+	case weight <= c.StrongNegative:
+		return StronglyNegative
+	case weight < c.NeutralLow:
+		return Negative
+	case weight <= c.NeutralHigh:
+		return Neutral
+	case weight < c.StrongPositive:
+		return Positive
+	}
+	return StronglyPositive
+}
+
+// Normalize maps a raw weight onto [-1, 1]. The mapping is monotonic and
+// preserves sign, so 0 stays 0.
+func (c Classifier) Normalize(weight float64) float64 {
+	scale := c.Scale
+	if scale <= 0 {
+		scale = DefaultClassifier.Scale
+	}
+	return math.Tanh(weight / scale)
+}
+
+// Stars maps a raw weight onto a 1-5 star scale, where 3 stars is a weight of
+// 0. The result is not rounded.
+func (c Classifier) Stars(weight float64) float64 {
+	return 3 + 2*c.Normalize(weight)
+}
+
+// ClassifyWeighted is a convenience function for classifying a Sentiment,
+// Sentence or Opinion.
+func (c Classifier) ClassifyWeighted(w Weighted) Polarity {
+	return c.Classify(w.Weight())
+}
+
+// NormalizeWeighted is a convenience function for normalizing the weight of a
+// Sentiment, Sentence or Opinion.
+func (c Classifier) NormalizeWeighted(w Weighted) float64 {
+	return c.Normalize(w.Weight())
+}
@@ -0,0 +1,56 @@
+package intellexer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	c := DefaultClassifier
+	assert.Equal(t, StronglyNegative, c.Classify(-2))
+	assert.Equal(t, StronglyNegative, c.Classify(-10))
+	assert.Equal(t, Negative, c.Classify(-1))
+	assert.Equal(t, Neutral, c.Classify(-0.5))
+	assert.Equal(t, Neutral, c.Classify(0))
+	assert.Equal(t, Neutral, c.Classify(0.5))
+	assert.Equal(t, Positive, c.Classify(1.7317706343552688))
+	assert.Equal(t, StronglyPositive, c.Classify(2.8))
+
+	custom := Classifier{StrongNegative: -1, StrongPositive: 1}
+	assert.Equal(t, Neutral, custom.Classify(0))
+	assert.Equal(t, Positive, custom.Classify(0.1))
+	assert.Equal(t, StronglyPositive, custom.Classify(1))
+	assert.Equal(t, "strongly positive", custom.Classify(1).String())
+	assert.Equal(t, "unknown", Polarity(7).String())
+
+	// The zero value uses the default thresholds
+	var zero Classifier
+	assert.Equal(t, Neutral, zero.Classify(0))
+	assert.Equal(t, Negative, zero.Classify(-1))
+	assert.Equal(t, StronglyNegative, zero.Classify(-2))
+	assert.Equal(t, Positive, zero.Classify(1))
+}
+
+func TestNormalize(t *testing.T) {
+	c := DefaultClassifier
+	assert.Equal(t, 0.0, c.Normalize(0))
+	assert.InDelta(t, 0.7616, c.Normalize(2), 0.0001)
+	assert.InDelta(t, -0.7616, c.Normalize(-2), 0.0001)
+	assert.InDelta(t, 1, c.Normalize(1000), 0.0001)
+	assert.Equal(t, 3.0, c.Stars(0))
+	assert.InDelta(t, 5, c.Stars(1000), 0.0001)
+	assert.InDelta(t, 1, c.Stars(-1000), 0.0001)
+
+	// Zero scale falls back to the default
+	assert.Equal(t, c.Normalize(1), Classifier{}.Normalize(1))
+}
+
+func TestWeighted(t *testing.T) {
+	c := DefaultClassifier
+	text := "love"
+	assert.Equal(t, StronglyPositive, c.ClassifyWeighted(Opinion{Text: &text, SentimentWeight: 2.8}))
+	assert.Equal(t, Negative, c.ClassifyWeighted(Sentence{SentimentWeight: -1}))
+	assert.Equal(t, Neutral, c.ClassifyWeighted(Sentiment{}))
+	assert.Equal(t, c.Normalize(1.5), c.NormalizeWeighted(Sentiment{SentimentWeight: 1.5}))
+}
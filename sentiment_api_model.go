@@ -1,6 +1,10 @@
 package intellexer
 
 import (
+	"encoding/json"
+	"fmt"
+	"time"
+
 	"github.com/google/uuid"
 )
 
@@ -43,10 +47,49 @@ type Sentiment struct {
 	// SentimentWeight is the positive or negative weight of this review.
 	SentimentWeight float64 `json:"w"`
 
-	// These fields don't seem to ever populate and are always null.
-	Author   *string `json:"author"`
-	Datetime *string `json:"dt"`
-	Title    *string `json:"title"`
+	// These fields are echoed back from the Review metadata, and are nil if the
+	// review did not include them.
+	Author   *string    `json:"author"`
+	Datetime *time.Time `json:"dt"`
+	Title    *string    `json:"title"`
+}
+
+// datetimeLayouts are the formats accepted for the "dt" field of a sentiment.
+// The API echoes back whatever it was sent, which is RFC3339 for reviews built
+// by this package, but the other layouts are accepted to be lenient.
+var datetimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// UnmarshalJSON decodes a sentiment, parsing the datetime field into a
+// time.Time. The datetime is only metadata echoed back by the API, so one that
+// isn't a string in a known layout leaves Datetime nil instead of failing the
+// whole response.
+func (s *Sentiment) UnmarshalJSON(data []byte) error {
+	// sentimentAlias has no methods, so decoding into it doesn't recurse.
+	type sentimentAlias Sentiment
+	raw := struct {
+		*sentimentAlias
+		Datetime json.RawMessage `json:"dt"`
+	}{sentimentAlias: (*sentimentAlias)(s)}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	s.Datetime = nil
+	var datetime string
+	if err := json.Unmarshal(raw.Datetime, &datetime); err != nil || len(datetime) == 0 {
+		return nil
+	}
+	for _, layout := range datetimeLayouts {
+		if dt, err := time.Parse(layout, datetime); err == nil {
+			s.Datetime = &dt
+			break
+		}
+	}
+	return nil
 }
 
 // Sentence is a sentence within the review that has been annotated with an XML-
@@ -71,22 +114,62 @@ type SentimentResponse struct {
 }
 
 // Review is the text and ID of a review that should be analyzed for sentiment.
+// The ID can be any non-empty string, but must be unique within a request.
+// Author, Title and Datetime are optional metadata that the API echoes back in
+// the corresponding Sentiment.
 type Review struct {
-	ID   uuid.UUID `json:"id"`
-	Text string    `json:"text"`
+	ID       string     `json:"id"`
+	Text     string     `json:"text"`
+	Author   string     `json:"author,omitempty"`
+	Title    string     `json:"title,omitempty"`
+	Datetime *time.Time `json:"dt,omitempty"`
 }
 
 // NewAnalyzeSentimentsRequestBody returns a new request body for the
 // /analyzeSentiments endpoint, generating UUIDs for each review. It is not
-// recommended to use this, callers are instead recommended to generate their
-// own UUIDs so they can be cross-referenced with the results.
+// recommended to use this, callers are instead recommended to use their own
+// IDs so they can be cross-referenced with the results.
 func NewAnalyzeSentimentsRequestBody(reviews []string) []Review {
 	var sentimentRequests []Review
 	for _, review := range reviews {
 		sentimentRequests = append(sentimentRequests, Review{
-			ID:   uuid.New(),
+			ID:   uuid.New().String(),
 			Text: review,
 		})
 	}
 	return sentimentRequests
 }
+
+// ReviewIDError is returned when a set of reviews can't be sent to the API
+// because one of the IDs is empty or is used more than once. The API matches
+// sentiments to reviews by ID, so ambiguous IDs would make the results
+// impossible to cross-reference.
+type ReviewIDError struct {
+	// ID is the offending ID, empty if the ID was missing.
+	ID string
+	// Index is the position of the offending review in the request.
+	Index int
+}
+
+func (err ReviewIDError) Error() string {
+	if len(err.ID) == 0 {
+		return fmt.Sprintf("Review at index %d has no ID", err.Index)
+	}
+	return fmt.Sprintf("Review at index %d has duplicate ID %q", err.Index, err.ID)
+}
+
+// ValidateReviews checks that every review has an ID and that no two reviews
+// share one. It returns a ReviewIDError for the first invalid review found.
+func ValidateReviews(reviews []Review) error {
+	seen := make(map[string]struct{}, len(reviews))
+	for i, review := range reviews {
+		if len(review.ID) == 0 {
+			return ReviewIDError{Index: i}
+		}
+		if _, ok := seen[review.ID]; ok {
+			return ReviewIDError{ID: review.ID, Index: i}
+		}
+		seen[review.ID] = struct{}{}
+	}
+	return nil
+}
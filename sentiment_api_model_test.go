@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -19,11 +20,16 @@ func TestNewSentimentsRequest(t *testing.T) {
 	assert.Equal(t, requestBody[0].Text, text1)
 	assert.Equal(t, requestBody[1].Text, text2)
 	assert.Equal(t, requestBody[2].Text, text3)
+	for _, review := range requestBody {
+		_, err := uuid.Parse(review.ID)
+		assert.Nil(t, err, "Generated IDs should be UUIDs")
+	}
+	assert.Nil(t, ValidateReviews(requestBody))
 }
 
 func TestJSONSerialization(t *testing.T) {
 	allZeros := uuid.UUID([16]byte{})
-	requestBody := []Review{{ID: allZeros, Text: "foo"}}
+	requestBody := []Review{{ID: allZeros.String(), Text: "foo"}}
 	bytes, err := json.Marshal(requestBody)
 
 	assert.Nil(t, err, "Request body should marshal without error")
@@ -34,6 +40,19 @@ func TestJSONSerialization(t *testing.T) {
 	)
 }
 
+func TestValidateReviews(t *testing.T) {
+	assert.Nil(t, ValidateReviews(nil))
+	assert.Nil(t, ValidateReviews([]Review{{ID: "1"}, {ID: "2"}, {ID: "ext-3"}}))
+
+	err := ValidateReviews([]Review{{ID: "1"}, {ID: "2"}, {ID: "1"}})
+	assert.Equal(t, ReviewIDError{ID: "1", Index: 2}, err)
+	assert.Equal(t, `Review at index 2 has duplicate ID "1"`, err.Error())
+
+	err = ValidateReviews([]Review{{ID: "1"}, {Text: "no id"}})
+	assert.Equal(t, ReviewIDError{Index: 1}, err)
+	assert.Equal(t, "Review at index 1 has no ID", err.Error())
+}
+
 func TestResponseDeserialization(t *testing.T) {
 	bytes, err := ioutil.ReadFile("testdata/analyze_sentiments_response.json")
 	assert.Nil(t, err, "testdata file should read without error")
@@ -48,6 +67,9 @@ func TestResponseDeserialization(t *testing.T) {
 	assert.Equal(t, 1.7317706343552688, sentiment.SentimentWeight)
 	assert.Equal(t, 1, res.SentimentsCount)
 	assert.Equal(t, Restaurants, res.Ontology)
+	assert.Nil(t, sentiment.Author)
+	assert.Nil(t, sentiment.Datetime)
+	assert.Nil(t, sentiment.Title)
 
 	topLevelOpinion := res.Opinions
 	assert.Nil(t, topLevelOpinion.Text)
@@ -70,3 +92,62 @@ func TestResponseDeserialization(t *testing.T) {
 	assert.Equal(t, 1, leafOpinion.F)
 	assert.Equal(t, 2.8, leafOpinion.SentimentWeight)
 }
+
+func TestReviewMetadataSerialization(t *testing.T) {
+	allZeros := uuid.UUID([16]byte{})
+	dt := time.Date(2019, 6, 1, 12, 30, 0, 0, time.UTC)
+	requestBody := []Review{{
+		ID:       allZeros.String(),
+		Text:     "foo",
+		Author:   "jdoe",
+		Title:    "Great",
+		Datetime: &dt,
+	}}
+	bytes, err := json.Marshal(requestBody)
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		`[{"id":"00000000-0000-0000-0000-000000000000","text":"foo","author":"jdoe","title":"Great","dt":"2019-06-01T12:30:00Z"}]`,
+		string(bytes),
+	)
+}
+
+func TestSentimentMetadataDeserialization(t *testing.T) {
+	var sentiment Sentiment
+	err := json.Unmarshal(
+		[]byte(`{"author":"jdoe","dt":"2019-06-01T12:30:00Z","id":"abc","title":"Great","w":1.5}`),
+		&sentiment,
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", sentiment.ID)
+	assert.Equal(t, 1.5, sentiment.SentimentWeight)
+	assert.Equal(t, "jdoe", *sentiment.Author)
+	assert.Equal(t, "Great", *sentiment.Title)
+	assert.True(t, time.Date(2019, 6, 1, 12, 30, 0, 0, time.UTC).Equal(*sentiment.Datetime))
+
+	sentiment = Sentiment{}
+	err = json.Unmarshal([]byte(`{"dt":"2019-06-01","id":"abc"}`), &sentiment)
+	assert.Nil(t, err)
+	assert.Nil(t, sentiment.Author)
+	assert.True(t, time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC).Equal(*sentiment.Datetime))
+
+	err = json.Unmarshal([]byte(`{"dt":null,"id":"abc"}`), &sentiment)
+	assert.Nil(t, err)
+	assert.Nil(t, sentiment.Datetime)
+
+	// Unparseable datetimes are dropped without failing the rest
+	for _, dt := range []string{`"last tuesday"`, `1559392200`, `{}`} {
+		sentiment = Sentiment{}
+		err = json.Unmarshal([]byte(`{"dt":`+dt+`,"id":"abc","w":2}`), &sentiment)
+		assert.Nil(t, err, dt)
+		assert.Nil(t, sentiment.Datetime, dt)
+		assert.Equal(t, "abc", sentiment.ID)
+		assert.Equal(t, 2.0, sentiment.SentimentWeight)
+	}
+
+	var res SentimentResponse
+	err = json.Unmarshal([]byte(`{"sentimentsCount":2,"sentiments":[{"id":"a","dt":"someday"},{"id":"b","dt":"2019-06-01"}]}`), &res)
+	assert.Nil(t, err)
+	assert.Nil(t, res.Sentiments[0].Datetime)
+	assert.NotNil(t, res.Sentiments[1].Datetime)
+}
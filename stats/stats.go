@@ -0,0 +1,315 @@
+// Package stats computes summary statistics over the results of the
+// intellexer sentiment analysis API. It aggregates one or many
+// SentimentResponses into reports containing the mean and median weights, the
+// polarity distribution, and the most positive and negative aspects found in
+// the Opinions tree.
+package stats
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/amccarthy1/intellexer"
+)
+
+// defaultTopAspects is the number of aspects kept in each direction if the
+// config does not specify one.
+const defaultTopAspects = 5
+
+// GroupFunc returns the name of the group that a sentiment belongs to. The
+// ontology passed in is the ontology of the response the sentiment came from.
+type GroupFunc func(ontology intellexer.Ontology, sentiment intellexer.Sentiment) string
+
+// ByOntology groups sentiments by the (lowercased) ontology they were analyzed
+// in.
+func ByOntology(ontology intellexer.Ontology, _ intellexer.Sentiment) string {
+	return strings.ToLower(string(ontology))
+}
+
+// ByMetadata groups sentiments using caller-provided metadata keyed by review
+// ID. Sentiments whose ID is not present in the map are grouped under
+// fallback.
+func ByMetadata(metadata map[string]string, fallback string) GroupFunc {
+	return func(_ intellexer.Ontology, sentiment intellexer.Sentiment) string {
+		if group, ok := metadata[sentiment.ID]; ok {
+			return group
+		}
+		return fallback
+	}
+}
+
+// Config controls how responses are aggregated.
+type Config struct {
+	// NeutralLow and NeutralHigh bound the neutral band. Weights within
+	// [NeutralLow, NeutralHigh] count as neutral, weights above it as positive
+	// and weights below it as negative. The zero value treats only a weight of
+	// exactly 0 as neutral.
+	NeutralLow  float64
+	NeutralHigh float64
+	// TopAspects is the number of aspects kept in each of the top positive and
+	// top negative lists. Defaults to 5.
+	TopAspects int
+	// GroupBy assigns sentiments to groups. If nil, no groups are reported.
+	GroupBy GroupFunc
+}
+
+// Distribution counts how many sentiments fell on each side of the neutral
+// band.
+type Distribution struct {
+	Positive int `json:"positive"`
+	Neutral  int `json:"neutral"`
+	Negative int `json:"negative"`
+}
+
+// Aspect is an aspect of the reviewed subject (e.g. "coffee") along with the
+// combined weight of all opinions expressed about it.
+type Aspect struct {
+	// Category is the ontology category the aspect was found under, e.g.
+	// "Drinks". It is empty for aspects directly under the root opinion.
+	Category string `json:"category"`
+	// Text is the aspect itself.
+	Text string `json:"text"`
+	// Weight is the sum of the weights of all opinions about this aspect.
+	Weight float64 `json:"weight"`
+	// Mentions is the number of opinions about this aspect.
+	Mentions int `json:"mentions"`
+}
+
+// Report is a statistical summary of a set of sentiments.
+type Report struct {
+	Count        int          `json:"count"`
+	Mean         float64      `json:"mean"`
+	Median       float64      `json:"median"`
+	Min          float64      `json:"min"`
+	Max          float64      `json:"max"`
+	Distribution Distribution `json:"distribution"`
+	TopPositive  []Aspect     `json:"topPositive"`
+	TopNegative  []Aspect     `json:"topNegative"`
+}
+
+// Summary is the result of aggregating responses. Overall covers every
+// sentiment, and Groups has one report per group if a GroupFunc was
+// configured.
+type Summary struct {
+	Overall Report             `json:"overall"`
+	Groups  map[string]*Report `json:"groups,omitempty"`
+}
+
+// Aggregator accumulates sentiment responses. The zero value is not usable,
+// create one with NewAggregator.
+type Aggregator struct {
+	config  Config
+	overall *accumulator
+	groups  map[string]*accumulator
+}
+
+// NewAggregator returns an empty aggregator using the given config.
+func NewAggregator(config Config) *Aggregator {
+	if config.TopAspects <= 0 {
+		config.TopAspects = defaultTopAspects
+	}
+	return &Aggregator{
+		config:  config,
+		overall: newAccumulator(),
+		groups:  make(map[string]*accumulator),
+	}
+}
+
+// Summarize is a convenience function that aggregates the given responses in
+// one call.
+func Summarize(config Config, responses ...*intellexer.SentimentResponse) Summary {
+	aggregator := NewAggregator(config)
+	for _, res := range responses {
+		aggregator.Add(res)
+	}
+	return aggregator.Summary()
+}
+
+// Add includes a response in the aggregate. Aspects from the response's
+// Opinions tree are only attributed to a group if every sentiment in the
+// response belongs to that group, since the API does not say which review an
+// opinion came from. They always count toward the overall report.
+func (a *Aggregator) Add(res *intellexer.SentimentResponse) {
+	if res == nil {
+		return
+	}
+	aspects := collectAspects(res.Opinions)
+	a.overall.addAspects(aspects)
+
+	responseGroup, singleGroup := "", true
+	for i, sentiment := range res.Sentiments {
+		a.overall.addWeight(sentiment.SentimentWeight)
+		if a.config.GroupBy == nil {
+			continue
+		}
+		group := a.config.GroupBy(res.Ontology, sentiment)
+		a.group(group).addWeight(sentiment.SentimentWeight)
+		if i == 0 {
+			responseGroup = group
+		} else if group != responseGroup {
+			singleGroup = false
+		}
+	}
+	if a.config.GroupBy != nil && len(res.Sentiments) > 0 && singleGroup {
+		a.group(responseGroup).addAspects(aspects)
+	}
+}
+
+// Summary computes reports from everything added so far.
+func (a *Aggregator) Summary() Summary {
+	summary := Summary{Overall: a.overall.report(a.config)}
+	if a.config.GroupBy != nil {
+		summary.Groups = make(map[string]*Report, len(a.groups))
+		for name, acc := range a.groups {
+			report := acc.report(a.config)
+			summary.Groups[name] = &report
+		}
+	}
+	return summary
+}
+
+func (a *Aggregator) group(name string) *accumulator {
+	acc, ok := a.groups[name]
+	if !ok {
+		acc = newAccumulator()
+		a.groups[name] = acc
+	}
+	return acc
+}
+
+type accumulator struct {
+	weights []float64
+	aspects map[string]*Aspect
+}
+
+func newAccumulator() *accumulator {
+	return &accumulator{aspects: make(map[string]*Aspect)}
+}
+
+func (acc *accumulator) addWeight(weight float64) {
+	acc.weights = append(acc.weights, weight)
+}
+
+func (acc *accumulator) addAspects(aspects []Aspect) {
+	for _, aspect := range aspects {
+		// The API is not consistent about capitalization, so merge aspects
+		// case-insensitively.
+		key := strings.ToLower(aspect.Category) + "\x00" + strings.ToLower(aspect.Text)
+		existing, ok := acc.aspects[key]
+		if !ok {
+			copied := aspect
+			acc.aspects[key] = &copied
+			continue
+		}
+		existing.Weight += aspect.Weight
+		existing.Mentions += aspect.Mentions
+	}
+}
+
+func (acc *accumulator) report(config Config) Report {
+	report := Report{Count: len(acc.weights)}
+	if len(acc.weights) > 0 {
+		sorted := make([]float64, len(acc.weights))
+		copy(sorted, acc.weights)
+		sort.Float64s(sorted)
+
+		var sum float64
+		for _, weight := range sorted {
+			sum += weight
+			switch {
+			case weight > config.NeutralHigh:
+				report.Distribution.Positive++
+			case weight < config.NeutralLow:
+				report.Distribution.Negative++
+			default:
+				report.Distribution.Neutral++
+			}
+		}
+		report.Mean = sum / float64(len(sorted))
+		report.Median = median(sorted)
+		report.Min = sorted[0]
+		report.Max = sorted[len(sorted)-1]
+	}
+	report.TopPositive, report.TopNegative = topAspects(acc.aspects, config.TopAspects)
+	return report
+}
+
+// median returns the median of an already sorted, non-empty slice.
+func median(sorted []float64) float64 {
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func topAspects(aspects map[string]*Aspect, n int) (positive, negative []Aspect) {
+	for _, aspect := range aspects {
+		if aspect.Weight > 0 {
+			positive = append(positive, *aspect)
+		} else if aspect.Weight < 0 {
+			negative = append(negative, *aspect)
+		}
+	}
+	// Ties are broken by text so that reports are deterministic.
+	sort.Slice(positive, func(i, j int) bool {
+		if positive[i].Weight != positive[j].Weight {
+			return positive[i].Weight > positive[j].Weight
+		}
+		return positive[i].Text < positive[j].Text
+	})
+	sort.Slice(negative, func(i, j int) bool {
+		if negative[i].Weight != negative[j].Weight {
+			return negative[i].Weight < negative[j].Weight
+		}
+		return negative[i].Text < negative[j].Text
+	})
+	if len(positive) > n {
+		positive = positive[:n]
+	}
+	if len(negative) > n {
+		negative = negative[:n]
+	}
+	return positive, negative
+}
+
+// collectAspects walks an opinion tree and returns the aspects in it. An
+// aspect is any node whose children are all leaves; the leaves are the
+// opinions expressed about it. The nearest ancestor with text is recorded as
+// the aspect's category.
+func collectAspects(root intellexer.Opinion) []Aspect {
+	var aspects []Aspect
+	var walk func(node intellexer.Opinion, category string)
+	walk = func(node intellexer.Opinion, category string) {
+		if isAspect(node) && node.Text != nil {
+			aspect := Aspect{Category: category, Text: *node.Text, Weight: node.SentimentWeight}
+			for _, opinion := range node.Children {
+				aspect.Weight += opinion.SentimentWeight
+				aspect.Mentions++
+			}
+			aspects = append(aspects, aspect)
+			return
+		}
+		childCategory := category
+		if node.Text != nil {
+			childCategory = *node.Text
+		}
+		for _, child := range node.Children {
+			walk(child, childCategory)
+		}
+	}
+	walk(root, "")
+	return aspects
+}
+
+func isAspect(node intellexer.Opinion) bool {
+	if len(node.Children) == 0 {
+		return false
+	}
+	for _, child := range node.Children {
+		if len(child.Children) > 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package stats
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/amccarthy1/intellexer"
+	"github.com/stretchr/testify/assert"
+)
+
+func loadResponse(t *testing.T) *intellexer.SentimentResponse {
+	bytes, err := ioutil.ReadFile("../testdata/analyze_sentiments_response.json")
+	assert.Nil(t, err, "testdata file should read without error")
+	var res intellexer.SentimentResponse
+	assert.Nil(t, json.Unmarshal(bytes, &res))
+	return &res
+}
+
+func str(s string) *string {
+	return &s
+}
+
+func TestSummarizeWeights(t *testing.T) {
+	res := &intellexer.SentimentResponse{
+		Ontology: intellexer.Gadgets,
+		Sentiments: []intellexer.Sentiment{
+			{ID: "a", SentimentWeight: 2},
+			{ID: "b", SentimentWeight: -1},
+			{ID: "c", SentimentWeight: 0.2},
+			{ID: "d", SentimentWeight: 5},
+		},
+	}
+	summary := Summarize(Config{NeutralLow: -0.5, NeutralHigh: 0.5}, res)
+	report := summary.Overall
+	assert.Equal(t, 4, report.Count)
+	assert.Equal(t, 1.55, report.Mean)
+	assert.Equal(t, 1.1, report.Median)
+	assert.Equal(t, -1.0, report.Min)
+	assert.Equal(t, 5.0, report.Max)
+	assert.Equal(t, Distribution{Positive: 2, Neutral: 1, Negative: 1}, report.Distribution)
+	assert.Nil(t, summary.Groups)
+
+	// Default band only treats exactly 0 as neutral
+	summary = Summarize(Config{}, res)
+	assert.Equal(t, Distribution{Positive: 3, Neutral: 0, Negative: 1}, summary.Overall.Distribution)
+}
+
+func TestSummarizeEmpty(t *testing.T) {
+	summary := Summarize(Config{}, nil, &intellexer.SentimentResponse{})
+	assert.Equal(t, 0, summary.Overall.Count)
+	assert.Equal(t, 0.0, summary.Overall.Mean)
+	assert.Empty(t, summary.Overall.TopPositive)
+}
+
+func TestAspects(t *testing.T) {
+	summary := Summarize(Config{TopAspects: 2}, loadResponse(t))
+	top := summary.Overall.TopPositive
+	assert.Len(t, top, 2)
+	assert.Equal(t, Aspect{Category: "Other", Text: "complex flavor", Weight: 4.95, Mentions: 1}, top[0])
+	assert.Equal(t, Aspect{Category: "Drinks", Text: "coffee", Weight: 2.8, Mentions: 1}, top[1])
+	assert.Empty(t, summary.Overall.TopNegative)
+
+	negative := &intellexer.SentimentResponse{
+		Opinions: intellexer.Opinion{Children: []intellexer.Opinion{{
+			Text: str("Service"),
+			Children: []intellexer.Opinion{{
+				Text: str("Waiter"),
+				Children: []intellexer.Opinion{
+					{Text: str("rude"), SentimentWeight: -3},
+					{Text: str("slow"), SentimentWeight: -1},
+				},
+			}},
+		}}},
+	}
+	summary = Summarize(Config{}, loadResponse(t), negative, negative)
+	assert.Len(t, summary.Overall.TopPositive, 3)
+	assert.Equal(t, []Aspect{{Category: "Service", Text: "Waiter", Weight: -8, Mentions: 4}}, summary.Overall.TopNegative)
+}
+
+func TestGrouping(t *testing.T) {
+	restaurants := loadResponse(t)
+	hotels := &intellexer.SentimentResponse{
+		Ontology: intellexer.Ontology("Hotels"),
+		Sentiments: []intellexer.Sentiment{
+			{ID: "x", SentimentWeight: -2},
+			{ID: "y", SentimentWeight: 4},
+		},
+	}
+	summary := Summarize(Config{GroupBy: ByOntology}, restaurants, hotels)
+	assert.Len(t, summary.Groups, 2)
+	assert.Equal(t, 1, summary.Groups["restaurants"].Count)
+	assert.Len(t, summary.Groups["restaurants"].TopPositive, 3)
+	assert.Equal(t, 2, summary.Groups["hotels"].Count)
+	assert.Equal(t, 1.0, summary.Groups["hotels"].Mean)
+	assert.Empty(t, summary.Groups["hotels"].TopPositive)
+	assert.Equal(t, 3, summary.Overall.Count)
+
+	metadata := map[string]string{"x": "web", "3fce35a7-b41c-4b75-b564-ec438cc30755": "web"}
+	summary = Summarize(Config{GroupBy: ByMetadata(metadata, "unknown")}, restaurants, hotels)
+	assert.Len(t, summary.Groups, 2)
+	assert.Equal(t, 2, summary.Groups["web"].Count)
+	assert.Equal(t, 1, summary.Groups["unknown"].Count)
+	// The restaurants response maps entirely to "web", so its aspects do too.
+	assert.Len(t, summary.Groups["web"].TopPositive, 3)
+	assert.Empty(t, summary.Groups["unknown"].TopPositive)
+}
@@ -0,0 +1,172 @@
+package intellexer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// sniffLen is the number of bytes http.DetectContentType looks at.
+const sniffLen = 512
+
+// ProgressFunc is called as a document is uploaded, with the number of bytes
+// sent so far and the total size of the document (0 if the size is unknown).
+type ProgressFunc func(sent, total int64)
+
+// DocumentTooLargeError is returned when a document is larger than the maximum
+// document size configured with WithMaxDocumentSize.
+type DocumentTooLargeError struct {
+	Limit int64
+}
+
+func (err DocumentTooLargeError) Error() string {
+	return fmt.Sprintf("Document exceeds maximum size of %d bytes", err.Limit)
+}
+
+// Upload is a document to be sent to the topic extraction endpoint.
+type Upload struct {
+	// Body is the content of the document.
+	Body io.Reader
+	// Size is the length of Body in bytes, or 0 if it is unknown. If Size is 0
+	// and Body has a Len method (like bytes.Reader and strings.Reader), the
+	// size is taken from that instead.
+	Size int64
+	// ContentType is sent as the Content-Type header if set.
+	ContentType string
+	// Progress, if set, is called after each chunk of the body is sent.
+	Progress ProgressFunc
+}
+
+// NewFileUpload returns an upload for an open file, taking the size from the
+// file's metadata and the content type from its extension, falling back to
+// sniffing the first few bytes. The caller is responsible for closing the
+// file once the upload is complete.
+func NewFileUpload(file *os.File) (Upload, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return Upload{}, errors.Wrap(err, "Error reading file info")
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(file.Name()))
+	if len(contentType) == 0 {
+		contentType, err = sniffContentType(file)
+		if err != nil {
+			return Upload{}, err
+		}
+	}
+	return Upload{
+		Body:        file,
+		Size:        info.Size(),
+		ContentType: contentType,
+	}, nil
+}
+
+func sniffContentType(file *os.File) (string, error) {
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", errors.Wrap(err, "Error reading file")
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", errors.Wrap(err, "Error rewinding file")
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// WithMaxDocumentSize sets the largest document, in bytes, that will be sent
+// for topic extraction. Larger documents fail with a DocumentTooLargeError,
+// before anything is sent if the size is known up front, and as soon as the
+// limit is passed otherwise. A limit of 0 (the default) means no limit.
+func (c *Client) WithMaxDocumentSize(limit int64) *Client {
+	c.maxDocumentSize = limit
+	return c
+}
+
+// GetTopicsFromUpload gets a list of topics from an uploaded document. The
+// upload is streamed to the server, and can be cancelled midway through by
+// cancelling ctx. See doc for "GetTopics" for performance information.
+func (c *Client) GetTopicsFromUpload(ctx context.Context, upload Upload) ([]string, error) {
+	size := upload.Size
+	if size <= 0 {
+		if lener, ok := upload.Body.(interface{ Len() int }); ok {
+			size = int64(lener.Len())
+		}
+	}
+	if c.maxDocumentSize > 0 && size > c.maxDocumentSize {
+		return nil, errors.WithStack(DocumentTooLargeError{c.maxDocumentSize})
+	}
+
+	body := &progressReader{
+		ctx:      ctx,
+		reader:   upload.Body,
+		total:    size,
+		limit:    c.maxDocumentSize,
+		progress: upload.Progress,
+	}
+	// A nil body is sent as an empty one, without wrapping it.
+	var reqBody io.Reader
+	if upload.Body != nil {
+		reqBody = body
+	}
+	url := fmt.Sprintf("%s?%s", getTopicsFromFileEndpoint, c.queryString())
+	req, err := http.NewRequest("POST", c.getPath(url), reqBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating request")
+	}
+	req = req.WithContext(ctx)
+	req.ContentLength = size
+	if len(upload.ContentType) > 0 {
+		req.Header.Set("Content-Type", upload.ContentType)
+	}
+	res, err := c.do(req)
+	if err != nil {
+		// Prefer the reader's own error, since the HTTP client obscures it.
+		if body.err != nil {
+			return nil, errors.Wrap(body.err, "Error sending request")
+		}
+		return nil, errors.Wrap(err, "Error sending request")
+	}
+	res, err = handleResponseErrorCodes(res)
+	if err != nil {
+		return nil, err
+	}
+	var topics []string
+	return topics, c.decodeRes(res, &topics)
+}
+
+// progressReader reports progress while reading, and stops reading if the
+// context is cancelled or the size limit is exceeded.
+type progressReader struct {
+	ctx      context.Context
+	reader   io.Reader
+	sent     int64
+	total    int64
+	limit    int64
+	progress ProgressFunc
+	err      error
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if err := r.ctx.Err(); err != nil {
+		r.err = err
+		return 0, err
+	}
+	n, err := r.reader.Read(p)
+	r.sent += int64(n)
+	if r.limit > 0 && r.sent > r.limit {
+		r.err = DocumentTooLargeError{r.limit}
+		return 0, r.err
+	}
+	if n > 0 && r.progress != nil {
+		r.progress(r.sent, r.total)
+	}
+	return n, err
+}
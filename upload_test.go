@@ -0,0 +1,139 @@
+package intellexer
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// newUploadServer returns a server that reads the whole request body and
+// responds with the canned topics response.
+func newUploadServer(t *testing.T, check func(r *http.Request, body []byte)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		check(r, body)
+		w.Write([]byte(`["Health.healthcare","Tech.information_technology"]`))
+	}))
+}
+
+func TestGetTopicsFromUpload(t *testing.T) {
+	article := "I'm an article about tech health care"
+	server := newUploadServer(t, func(r *http.Request, body []byte) {
+		assert.Equal(t, "/getTopicsFromFile", r.URL.Path)
+		assert.Equal(t, int64(len(article)), r.ContentLength)
+		assert.Equal(t, "text/plain", r.Header.Get("Content-Type"))
+		assert.Equal(t, article, string(body))
+	})
+	defer server.Close()
+
+	apiClient := NewClient("test").WithBaseURL(server.URL).WithHTTPClient(http.DefaultClient)
+	var calls int
+	var lastSent, lastTotal int64
+	topics, err := apiClient.GetTopicsFromUpload(context.Background(), Upload{
+		Body:        strings.NewReader(article),
+		ContentType: "text/plain",
+		Progress: func(sent, total int64) {
+			calls++
+			lastSent, lastTotal = sent, total
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Health.healthcare", "Tech.information_technology"}, topics)
+	assert.True(t, calls > 0)
+	assert.Equal(t, int64(len(article)), lastSent)
+	assert.Equal(t, int64(len(article)), lastTotal)
+}
+
+func TestGetTopicsNilBody(t *testing.T) {
+	server := newUploadServer(t, func(r *http.Request, body []byte) {
+		assert.Empty(t, body)
+	})
+	defer server.Close()
+	apiClient := NewClient("test").WithBaseURL(server.URL).WithHTTPClient(http.DefaultClient)
+	topics, err := apiClient.GetTopics(nil)
+	assert.Nil(t, err)
+	assert.Len(t, topics, 2)
+}
+
+func TestNewFileUpload(t *testing.T) {
+	file, err := os.Open("testdata/content_type_error.xhtml")
+	assert.Nil(t, err)
+	defer file.Close()
+	info, err := file.Stat()
+	assert.Nil(t, err)
+
+	upload, err := NewFileUpload(file)
+	assert.Nil(t, err)
+	assert.Equal(t, info.Size(), upload.Size)
+	assert.Equal(t, "application/xhtml+xml", upload.ContentType)
+
+	// No extension, so the type is sniffed and the file rewound
+	tmp, err := ioutil.TempFile("", "article")
+	assert.Nil(t, err)
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	tmp.WriteString("just some plain text")
+	tmp.Seek(0, io.SeekStart)
+	upload, err = NewFileUpload(tmp)
+	assert.Nil(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", upload.ContentType)
+	body, err := ioutil.ReadAll(upload.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "just some plain text", string(body))
+}
+
+func TestMaxDocumentSize(t *testing.T) {
+	server := newUploadServer(t, func(*http.Request, []byte) {})
+	defer server.Close()
+	apiClient := NewClient("test").
+		WithBaseURL(server.URL).
+		WithHTTPClient(http.DefaultClient).
+		WithMaxDocumentSize(10)
+
+	// Known size is rejected before sending
+	topics, err := apiClient.GetTopicsFromText("this is longer than ten bytes")
+	assert.Nil(t, topics)
+	assert.Equal(t, DocumentTooLargeError{10}, errors.Cause(err))
+
+	// Unknown size is rejected while streaming
+	reader := io.MultiReader(strings.NewReader("this is longer "), strings.NewReader("than ten bytes"))
+	topics, err = apiClient.GetTopics(reader)
+	assert.Nil(t, topics)
+	assert.NotNil(t, err)
+	assert.Equal(t, DocumentTooLargeError{10}, errors.Cause(err))
+	assert.Equal(t, "Document exceeds maximum size of 10 bytes", errors.Cause(err).Error())
+
+	topics, err = apiClient.GetTopicsFromText("short")
+	assert.Nil(t, err)
+	assert.Len(t, topics, 2)
+}
+
+func TestUploadCancellation(t *testing.T) {
+	server := newUploadServer(t, func(*http.Request, []byte) {})
+	defer server.Close()
+	apiClient := NewClient("test").WithBaseURL(server.URL).WithHTTPClient(http.DefaultClient)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reader := io.MultiReader(strings.NewReader("first chunk "), strings.NewReader("second chunk"))
+	topics, err := apiClient.GetTopicsFromUpload(ctx, Upload{
+		Body: reader,
+		Progress: func(sent, total int64) {
+			cancel()
+		},
+	})
+	assert.Nil(t, topics)
+	assert.NotNil(t, err)
+	assert.Equal(t, context.Canceled, errors.Cause(err))
+}